@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Raw shapes of Clang's `-ast-dump=json` output. They are only used while decoding,
+// right after that everything is converted into Node trees (see node.go).
+type json_node struct {
+	ID                string          `json:"id"`
+	Kind              string          `json:"kind"`
+	Loc               *json_loc       `json:"loc"`
+	Range             *json_range     `json:"range"`
+	PreviousDecl      string          `json:"previousDecl"`
+	Name              string          `json:"name"`
+	Type              *json_type      `json:"type"`
+	StorageClass      string          `json:"storageClass"`
+	TagUsed           string          `json:"tagUsed"`
+	Init              string          `json:"init"`
+	Value             json.RawMessage `json:"value"` // a string for most literals, a number for CharacterLiteral
+	Opcode            string          `json:"opcode"`
+	ArgType           *json_type      `json:"argType"`
+	ArrayFiller       []*json_node    `json:"array_filler"`
+	DeclID            string          `json:"declId"`
+	TargetLabelDeclID string          `json:"targetLabelDeclId"`
+	IsPostfix         bool            `json:"isPostfix"`
+	ReferencedDecl    *json_ref_decl  `json:"referencedDecl"`
+	Inner             []*json_node    `json:"inner"`
+}
+
+type json_loc struct {
+	Offset       *int       `json:"offset"`
+	File         string     `json:"file"`
+	Line         int        `json:"line"`
+	TokLen       int        `json:"tokLen"`
+	IncludedFrom *json_file `json:"includedFrom"`
+	SpellingLoc  *json_loc  `json:"spellingLoc"`
+	ExpansionLoc *json_loc  `json:"expansionLoc"`
+}
+
+type json_range struct {
+	Begin *json_loc `json:"begin"`
+	End   *json_loc `json:"end"`
+}
+
+type json_file struct {
+	File string `json:"file"`
+}
+
+type json_type struct {
+	DesugaredQualType string `json:"desugaredQualType"`
+	QualType          string `json:"qualType"`
+}
+
+type json_ref_decl struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// ast_decoder converts json_node trees into Node trees.
+//
+// Clang only writes `file` (and `line`) of a location when it differs from the
+// previously written location, so the decoder has to visit locations in the same
+// order Clang wrote them and remember the last seen values.
+type ast_decoder struct {
+	last_file string
+	last_line int
+}
+
+// bare_loc is a single resolved location (no spelling/expansion pair).
+type bare_loc struct {
+	offset        int
+	file          string
+	line          int
+	tok_len       int
+	included_from string
+}
+
+func json_decode(content string) (*Node, error) {
+	return json_decode_stream(strings.NewReader(content), false)
+}
+
+func json_decode_file(ast_path string) (*Node, error) {
+	f, err := os.Open(ast_path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return json_decode_stream(bufio.NewReaderSize(f, 1<<20), true)
+}
+
+// json_decode_stream reads the TranslationUnitDecl object token by token, so that
+// only one top level declaration is held in its raw form at a time.
+// A file including system headers easily produces a few hundred MB of JSON,
+// almost all of it libc declarations. With `skip_builtin` those are dropped
+// right after they are decoded.
+func json_decode_stream(r io.Reader, skip_builtin bool) (*Node, error) {
+	dec := json.NewDecoder(r)
+	if err := expect_delim(dec, '{'); err != nil {
+		return nil, err
+	}
+	d := ast_decoder{}
+	var root json_node
+	var root_node *Node
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := tok.(string)
+		if key != "inner" {
+			if err := decode_root_field(dec, key, &root); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		// Clang writes `inner` last, the root header is complete at this point.
+		root_node = d.node(&root)
+		if err := expect_delim(dec, '['); err != nil {
+			return nil, err
+		}
+		for dec.More() {
+			var jn json_node
+			if err := dec.Decode(&jn); err != nil {
+				return nil, err
+			}
+			node := d.node(&jn)
+			if skip_builtin && node.is_builtin() {
+				root_node.dropped_builtins++
+				continue
+			}
+			root_node.inner = append(root_node.inner, node)
+		}
+		if err := expect_delim(dec, ']'); err != nil {
+			return nil, err
+		}
+	}
+	if err := expect_delim(dec, '}'); err != nil {
+		return nil, err
+	}
+	if root_node == nil {
+		root_node = d.node(&root)
+	}
+	return root_node, nil
+}
+
+func decode_root_field(dec *json.Decoder, key string, root *json_node) error {
+	switch key {
+	case "id":
+		return dec.Decode(&root.ID)
+	case "kind":
+		return dec.Decode(&root.Kind)
+	case "loc":
+		return dec.Decode(&root.Loc)
+	case "range":
+		return dec.Decode(&root.Range)
+	}
+	var skipped json.RawMessage
+	return dec.Decode(&skipped)
+}
+
+func expect_delim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != want {
+		return fmt.Errorf("unexpected token %v in AST JSON, want %v", tok, want)
+	}
+	return nil
+}
+
+func (d *ast_decoder) node(jn *json_node) *Node {
+	node := &Node{
+		id:                   jn.ID,
+		kind_str:             jn.Kind,
+		previous_declaration: jn.PreviousDecl,
+		name:                 jn.Name,
+		class_modifier:       jn.StorageClass,
+		tags:                 jn.TagUsed,
+		initialization_type:  jn.Init,
+		opcode:               jn.Opcode,
+		declaration_id:       jn.DeclID,
+		label_id:             jn.TargetLabelDeclID,
+		is_postfix:           jn.IsPostfix,
+	}
+	node.kind = convert_str_into_node_kind(jn.Kind)
+	// Order matters here: `loc` is written before `range`, `begin` before `end`.
+	node.location = d.location(jn.Loc)
+	if jn.Range != nil {
+		node.range0.begin = d.range_end(jn.Range.Begin)
+		node.range0.end = d.range_end(jn.Range.End)
+	}
+	if jn.Type != nil {
+		node.ast_type = AstJsonType{
+			desugared_qualified: jn.Type.DesugaredQualType,
+			qualified:           jn.Type.QualType,
+		}
+	}
+	if jn.ArgType != nil {
+		node.ast_argument_type = AstJsonType{
+			desugared_qualified: jn.ArgType.DesugaredQualType,
+			qualified:           jn.ArgType.QualType,
+		}
+	}
+	if jn.ReferencedDecl != nil {
+		node.ref_declaration = RefDeclarationNode{
+			kind_str: jn.ReferencedDecl.Kind,
+			name:     jn.ReferencedDecl.Name,
+			kind:     convert_str_into_node_kind(jn.ReferencedDecl.Kind),
+		}
+	}
+	node.value, node.value_number = decode_value(jn.Value)
+	for _, child := range jn.ArrayFiller {
+		node.array_filler = append(node.array_filler, d.node(child))
+	}
+	for _, child := range jn.Inner {
+		node.inner = append(node.inner, d.node(child))
+	}
+	return node
+}
+
+// `"value": "777"` (IntegerLiteral), `"value": 97` (CharacterLiteral) or
+// `"value": true` (CXXBoolLiteralExpr)
+func decode_value(raw json.RawMessage) (string, int) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return "", 0
+	}
+	if raw[0] == '"' {
+		s := ""
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return "", 0
+		}
+		return s, 0
+	}
+	s := string(raw)
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		// bools and floats
+		return s, 0
+	}
+	return s, n
+}
+
+func (d *ast_decoder) location(jl *json_loc) NodeLocation {
+	if jl == nil {
+		return NodeLocation{}
+	}
+	if jl.SpellingLoc != nil || jl.ExpansionLoc != nil {
+		// Macro expansion: Clang writes `spellingLoc` first, then `expansionLoc`.
+		spelling := d.bare(jl.SpellingLoc)
+		expansion := d.bare(jl.ExpansionLoc)
+		return NodeLocation{
+			offset:        expansion.offset,
+			file:          expansion.file,
+			line:          expansion.line,
+			source_file:   SourceFile{path: expansion.included_from},
+			spelling_file: SourceFile{path: spelling.file},
+		}
+	}
+	loc := d.bare(jl)
+	return NodeLocation{
+		offset:      loc.offset,
+		file:        loc.file,
+		line:        loc.line,
+		source_file: SourceFile{path: loc.included_from},
+	}
+}
+
+func (d *ast_decoder) range_end(jl *json_loc) Begin {
+	if jl == nil {
+		return Begin{}
+	}
+	if jl.SpellingLoc != nil || jl.ExpansionLoc != nil {
+		spelling := d.bare(jl.SpellingLoc)
+		expansion := d.bare(jl.ExpansionLoc)
+		return Begin{
+			offset:        expansion.offset,
+			file:          expansion.file,
+			line:          expansion.line,
+			tok_len:       expansion.tok_len,
+			spelling_file: SourceFile{path: spelling.file},
+		}
+	}
+	loc := d.bare(jl)
+	return Begin{
+		offset:  loc.offset,
+		file:    loc.file,
+		line:    loc.line,
+		tok_len: loc.tok_len,
+	}
+}
+
+// Builtin types have completely empty `"loc": {}` objects, those are invalid
+// locations and don't update the inherited file/line.
+func (d *ast_decoder) bare(jl *json_loc) bare_loc {
+	if jl == nil || jl.Offset == nil {
+		return bare_loc{}
+	}
+	if jl.File != "" {
+		d.last_file = jl.File
+	}
+	if jl.Line != 0 {
+		d.last_line = jl.Line
+	}
+	loc := bare_loc{
+		offset:  *jl.Offset,
+		file:    d.last_file,
+		line:    d.last_line,
+		tok_len: jl.TokLen,
+	}
+	if jl.IncludedFrom != nil {
+		loc.included_from = jl.IncludedFrom.File
+	}
+	return loc
+}
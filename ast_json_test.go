@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const test_ast_json = `{
+  "id": "0x1", "kind": "TranslationUnitDecl", "loc": {}, "range": {"begin": {}, "end": {}},
+  "inner": [
+    {"id": "0x2", "kind": "TypedefDecl", "loc": {}, "range": {"begin": {}, "end": {}},
+     "isImplicit": true, "name": "__int128_t", "type": {"qualType": "__int128"}},
+    {"id": "0x3", "kind": "FunctionDecl",
+     "loc": {"offset": 4, "file": "a.c", "line": 1, "col": 5, "tokLen": 4},
+     "range": {"begin": {"offset": 0, "col": 1, "tokLen": 3}, "end": {"offset": 40, "line": 3, "col": 1, "tokLen": 1}},
+     "name": "main", "type": {"qualType": "int (void)"},
+     "inner": [
+       {"id": "0x4", "kind": "CharacterLiteral", "range": {"begin": {"offset": 20, "line": 2, "col": 3, "tokLen": 3}, "end": {"offset": 20, "col": 3, "tokLen": 3}},
+        "type": {"qualType": "int"}, "valueCategory": "prvalue", "value": 97},
+       {"id": "0x5", "kind": "IntegerLiteral", "type": {"qualType": "int"}, "value": "777"},
+       {"id": "0x6", "kind": "DeclRefExpr", "type": {"qualType": "int"},
+        "referencedDecl": {"id": "0x7", "kind": "EnumConstantDecl", "name": "RED", "type": {"qualType": "int"}}}
+     ]},
+    {"id": "0x8", "kind": "VarDecl",
+     "loc": {"offset": 50, "line": 5, "col": 5, "tokLen": 1},
+     "range": {"begin": {"offset": 46, "col": 1, "tokLen": 6}, "end": {"offset": 50, "col": 5, "tokLen": 1}},
+     "previousDecl": "0x3", "name": "x", "type": {"qualType": "dirtype_t", "desugaredQualType": "unsigned int"},
+     "storageClass": "extern"}
+  ]
+}`
+
+func TestJsonDecode(t *testing.T) {
+	root, err := json_decode(test_ast_json)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(root.inner) != 3 {
+		t.Fatalf("Result: %v top level nodes, want: 3", len(root.inner))
+	}
+	if !root.inner[0].is_builtin() {
+		t.Errorf("implicit typedef with an empty loc should be builtin")
+	}
+
+	fn := root.inner[1]
+	if fn.kind != function_decl || fn.ast_type.qualified != "int (void)" {
+		t.Errorf("Result: %v %q, want: FunctionDecl \"int (void)\"", fn.kind.str(), fn.ast_type.qualified)
+	}
+	if fn.range0.begin.file != "a.c" || fn.range0.end.offset != 40 {
+		t.Errorf("range was not decoded: %+v", fn.range0)
+	}
+	if ch := fn.inner[0]; ch.value_number != 97 {
+		t.Errorf("Result: %v, want: 97", ch.value_number)
+	}
+	if lit := fn.inner[1]; lit.value != "777" {
+		t.Errorf("Result: %v, want: 777", lit.value)
+	}
+	if ref := fn.inner[2].ref_declaration; ref.kind != enum_constant_decl || ref.name != "RED" {
+		t.Errorf("referencedDecl was not decoded: %+v", ref)
+	}
+
+	// `file` is omitted, it is inherited from the previous location
+	global := root.inner[2]
+	if global.location.file != "a.c" || global.location.line != 5 {
+		t.Errorf("Result: %v:%v, want: a.c:5", global.location.file, global.location.line)
+	}
+	if global.ast_type.desugared_qualified != "unsigned int" || global.class_modifier != "extern" ||
+		global.previous_declaration != "0x3" {
+		t.Errorf("decl fields were not decoded: %+v", global)
+	}
+}
+
+func TestJsonDecodeStreamSkipsBuiltins(t *testing.T) {
+	root, err := json_decode_stream(strings.NewReader(test_ast_json), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(root.inner) != 2 || root.inner[0].name != "main" {
+		t.Fatalf("builtin typedef was not dropped: %v nodes", len(root.inner))
+	}
+	// Location inheritance must still see the dropped nodes
+	if root.inner[1].location.file != "a.c" {
+		t.Errorf("Result: %v, want: a.c", root.inner[1].location.file)
+	}
+	if root.kind != translation_unit_decl {
+		t.Errorf("Result: %v, want: TranslationUnitDecl", root.kind.str())
+	}
+}
@@ -3,9 +3,10 @@ package main
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -64,8 +65,6 @@ func in_builtin_global_names(tname string) bool {
 	return false
 }
 
-var tabs = []string{"", "\t", "\t\t", "\t\t\t", "\t\t\t\t", "\t\t\t\t\t"}
-
 var cur_dir string
 
 type Type struct {
@@ -74,11 +73,6 @@ type Type struct {
 	is_static bool
 }
 
-func find_clang_in_path() string {
-	// Empty
-	return ""
-}
-
 type LabelStmt struct {
 	name string
 }
@@ -88,30 +82,24 @@ type C2V struct {
 	is_dir          bool // when translating a directory (multiple C=>V files)
 	c_file_contents string
 	line_i          int
-	node_i          int      // when parsing nodes
-	unhandled_nodes []string // when coming across an unknown Clang AST node
+	node_i          int                 // when parsing nodes
+	errors          []*TranslationError // of the current file, see add_error()
+	report          *FileReport         // of the current file, see report.go
+	macros          []*Macro            // dumped by `clang -dM -E`, see macros.go
+	macro_consts    map[string]*Macro   // the translated object-like macros of the file
+	comment_pos     int                 // the offset in c_file_contents up to which comments were generated
 	// out  stuff
-	out                 str_builder       // os.File
-	globals_out         map[string]string // `globals_out["myglobal"] == "extern int myglobal = 0;"` // strings.Builder
+	out                 code_buffer
 	out_file            os_file
-	out_line_empty      bool
-	types               []string            // to avoid dups
-	enums               []string            // to avoid dups
-	enum_vals           map[string]*str_arr // enum_vals["Color"] = ["green", "blue"], for converting C globals  to enum values
-	fns                 []string            // to avoid dups
+	fns                 []string // to avoid dups
 	outv                string
 	cur_file            string
-	consts              []string
-	globals             map[string]*Global
 	inside_switch       int // used to be a bool, a counter to handle switches inside switches
 	inside_switch_enum  bool
 	inside_for          bool // to handle `;;++i`
 	inside_array_index  bool // for enums used as int array index: `if player.weaponowned[.wp_chaingun]`
 	global_struct_init  string
-	cur_out_line        string
 	inside_main         bool
-	indent              int
-	empty_line          bool // for indents
 	is_wrapper          bool
 	wrapper_module_name string // name of the wrapper module
 	nm_lines            []string
@@ -119,8 +107,8 @@ type C2V struct {
 	skip_parens         bool              // for skipping unnecessary params like in `enum Foo { bar = (1+2) }`
 	labels              map[string]string // for goto stmts: `label_stmts[label_id] == "labelname"`
 	//
-	project_folder string // the final folder passed on the CLI, or the folder of the last file, passed on the CLI. Will be used for searching for a c2v.toml file, containing project configuration overrides, when the C2V_CONFIG env variable is not set explicitly.
-	//conf           toml.Doc = empty_toml_doc() // conf will be set by parsing the TOML configuration file
+	project_folder string  // the final folder passed on the CLI, or the folder of the last file, passed on the CLI. Will be used for searching for a c2v.toml file, containing project configuration overrides, when the C2V_CONFIG env variable is not set explicitly.
+	conf           TomlDoc // conf will be set by parsing the TOML configuration file
 	//
 	project_output_dirname   string // by default, "c2v_out.dir"; override with `[project] output_dirname = "another"`
 	project_additional_flags string // what to pass to clang, so that it could parse all the input files; mainly -I directives to find additional headers; override with `[project] additional_flags = "-I/some/folder"`
@@ -129,10 +117,27 @@ type C2V struct {
 	//
 	project_globals_path string // where to store the _globals.v file, that will contain all the globals/consts for the project folder; calculated using project_output_dirname and project_folder
 	//
-	translations            int   // how many translations were done so far
 	translation_start_ticks int64 // initialised before the loop calling .translate_file()
-	has_cfile               bool
 	returning_bool          bool
+	emitter                 Emitter                   // renders V or Go (`-target=go`) code
+	target                  string                    // "v" or "go"
+	jobs                    int                       // how many files are translated concurrently (`-j N`)
+	output_dir              string                    // `-o dir`, see output_root()
+	cli_clang_flags         string                    // `-cflags="-Iinclude -DNDEBUG"`, added to the flags of c2v.toml
+	keep_ast                bool                      // `-keep_ast`, don't delete the .json ASTs dumped by clang
+	print_tree              bool                      // `-print_tree`
+	check_only              bool                      // `c2v check`, nothing is written
+	report_path             string                    // `-report out.json`, see report.go
+	stubs                   bool                      // `-stubs`, see stubs.go
+	offline                 bool                      // `-offline`, translate the .json ASTs of a folder instead of running clang
+	c_file_path             string                    // `-c_file=file.c`, the C file of an offline AST
+	clang_path              string                    // `-clang=/usr/bin/clang-18` or `[project] clang`, found in PATH by default
+	compile_commands_path   string                    // `-compile_commands=build/compile_commands.json`
+	compile_commands        map[string]CompileCommand // by the absolute path of the .c file
+	include_globs           []string                  // `-include=src/**/*.c`, only matching files of a folder are translated
+	exclude_globs           []string                  // `-exclude=test*`
+	proj                    *Project                  // shared by all the files of the project
+	turn                    <-chan struct{}           // closed when the previous file of the project is translated, see translate_files()
 }
 
 type Global struct {
@@ -163,76 +168,12 @@ func (p *str_arr) add(s string) {
 	p.inner = append(p.inner, s)
 }
 
-type str_builder struct {
-	arr str_arr
-}
-
-func (p *str_builder) write_string(s string) {
-	p.arr.inner = append(p.arr.inner, s)
-}
-
-func (p *str_builder) writeln(s string) {
-	p.arr.inner = append(p.arr.inner, s) // ?
-}
-
-func (p *str_builder) cut_to(pos int) string {
-	s := p.str()
-	return s[:pos]
-}
-
-// helper
-func (p *str_builder) str() string {
-	s := ""
-	for _, val := range p.arr.inner {
-		s += val + ", "
-	}
-	return s
-}
-
-func filter_line(s string) string {
-	s1 := strings.ReplaceAll(s, "false_", "false")
-	s1 = strings.ReplaceAll(s, "true_", "true")
-	return s1
-}
-
 func (c *C2V) genln(s string) {
-	if c.indent > 0 && c.out_line_empty {
-		c.out.write_string(tabs[c.indent])
-	}
-	if c.cur_out_line != "" {
-		c.out.write_string(filter_line(c.cur_out_line))
-		c.cur_out_line = ""
-	}
-	c.out.writeln(filter_line(s))
-	c.out_line_empty = true
+	c.out.genln(s)
 }
 
 func (c *C2V) gen(s string) {
-	if c.indent > 0 && c.out_line_empty {
-		c.out.write_string(tabs[c.indent])
-	}
-	c.cur_out_line += s
-	c.out_line_empty = false
-}
-
-func vprintln(s string) {
-	// TODO parse variables in string
-	fmt.Printf("%s\n", s)
-}
-
-func vprintf(format string, a ...any) {
-	// TODO parse variables in string
-	fmt.Printf(format, a...)
-}
-
-func vprint(s string) {
-	// TODO parse variables in string
-	fmt.Printf("%s", s)
-}
-
-func eprintln(s string) {
-	// TODO parse variables in string
-	fmt.Printf("%s\n", s)
+	c.out.gen(s)
 }
 
 func map2str(smap map[string]string) string {
@@ -245,19 +186,7 @@ func map2str(smap map[string]string) string {
 	return s
 }
 
-type os_file struct {
-}
-
-func (p *os_file) write_string(s string) bool {
-	// TODO implement
-	return false
-}
-
-func (p *os_file) close() {
-	// TODO implement
-}
-
-func (c *C2V) save() {
+func (c *C2V) save() error {
 	vprintln("\n\n")
 	s := c.out.str()
 	vprintf("VVVV len=%d\n", len(c.labels))
@@ -266,18 +195,29 @@ func (c *C2V) save() {
 	// Because JSON AST doesn't have label names for some reason, just IDs.
 	if len(c.labels) > 0 {
 		for label_name, label_id := range c.labels {
-			vprintf(`%v" => "%v\n`, label_id, label_name)
+			vprintf("%v\" => \"%v\n", label_id, label_name)
 			s = strings.ReplaceAll(s, "_GOTO_PLACEHOLDER_"+label_id, label_name)
 		}
 	}
+	s = c.emitter.file_header(s) + s
+	if c.check_only {
+		return nil
+	}
 
-	if !c.out_file.write_string(s) {
-		// TODO error handling
-		panic("failed to write to the .v file: ${err}")
+	out_file, err := create_out_file(c.outv)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", c.outv, err)
+	}
+	c.out_file = out_file
+	if err := c.out_file.write_string(s); err != nil {
+		c.out_file.abort()
+		return fmt.Errorf("failed to write to %s: %v", c.outv, err)
+	}
+	if err := c.out_file.close(); err != nil {
+		return fmt.Errorf("failed to save %s: %v", c.outv, err)
 	}
-	c.out_file.close()
 	if strings.Contains(s, "FILE") {
-		c.has_cfile = true
+		c.proj.set_has_cfile()
 	}
 
 	// unsupported
@@ -286,6 +226,7 @@ func (c *C2V) save() {
 			os.system("v fmt -translated -w ${c.outv} > /dev/null")
 		}
 	*/
+	return nil
 }
 
 // recursive
@@ -301,19 +242,69 @@ func set_kind_enum(n *Node) {
 	}
 }
 
-func new_c2v(args []string) *C2V {
+// new_c2v applies the flags validated by parse_command_line()
+func new_c2v(args []CliArg) *C2V {
 	c2v := new(C2V)
 	c2v.is_wrapper = false
+	c2v.project_output_dirname = "c2v_out.dir"
+	c2v.labels = map[string]string{}
+	c2v.report = &FileReport{}
+	c2v.conf = empty_toml_doc()
+	c2v.proj = new_project()
+	c2v.target = "v"
+	c2v.jobs = 1
+	for _, arg := range args {
+		switch arg.name {
+		case "-target=":
+			c2v.target = arg.value
+		case "-data_model=":
+			data_model = lp64
+			if arg.value == "llp64" {
+				data_model = llp64
+			}
+		case "-stubs":
+			c2v.stubs = true
+		case "-offline":
+			c2v.offline = true
+		case "-c_file=":
+			c2v.c_file_path = arg.value
+		case "-clang=":
+			c2v.clang_path = arg.value
+		case "-compile_commands=":
+			c2v.compile_commands_path = arg.value
+		case "-include=":
+			c2v.include_globs = append(c2v.include_globs, split(arg.value, ",")...)
+		case "-exclude=":
+			c2v.exclude_globs = append(c2v.exclude_globs, split(arg.value, ",")...)
+		case "-j":
+			c2v.jobs, _ = strconv.Atoi(arg.value)
+		case "-o":
+			c2v.output_dir = arg.value
+		case "-module=":
+			c2v.wrapper_module_name = arg.value
+		case "-cflags=":
+			c2v.cli_clang_flags = arg.value
+		case "-keep_ast":
+			c2v.keep_ast = true
+		case "-print_tree":
+			c2v.print_tree = true
+		case "-report":
+			c2v.report_path = arg.value
+		case "-q":
+			log_level = log_quiet
+		case "-v":
+			log_level = log_debug
+		case "-vv":
+			log_level = log_trace
+		}
+	}
+	c2v.emitter = new_emitter(c2v, c2v.target)
 
 	//c2v.handle_configuration(args)
 	return c2v
 }
 
-func json_decode(content string) *Node {
-	return nil
-}
-
-func (c2v *C2V) add_file(ast_path string, outv string, c_file string) {
+func (c2v *C2V) add_file(ast_path string, outv string, c_file string) error {
 	vprintf("new tree(outv=%v c_file=%s)\n", outv, c_file)
 
 	c_file_contents := ""
@@ -323,35 +314,30 @@ func (c2v *C2V) add_file(ast_path string, outv string, c_file string) {
 		var err error
 		c_file_contents, err = ReadTextFile(c_file)
 		if err != nil {
-			fmt.Printf("Cannot read file: %s!\n", c_file)
-			return
+			return fmt.Errorf("cannot read %s: %v", c_file, err)
 		}
 	}
-	ast_txt, err := ReadTextFile(ast_path)
+	// Builtin top level nodes are dropped while decoding, see json_decode_stream()
+	tree, err := json_decode_file(ast_path)
 	if err != nil {
-		vprintln("failed to read ast file " + ast_path + ": ${err}")
-		panic(err)
+		return fmt.Errorf("failed to read the AST file %s: %v", ast_path, err)
+	}
+	c2v.tree = tree
+	c2v.report.SkippedBuiltins += tree.dropped_builtins
+	if err := c2v.load_macros(ast_path); err != nil {
+		return fmt.Errorf("failed to read the macros of %s: %v", ast_path, err)
 	}
-	// TODO parse Json file
-	c2v.tree = json_decode(ast_txt)
 
 	c2v.outv = outv
 	c2v.c_file_contents = c_file_contents
+	c2v.comment_pos = 0
 	c2v.cur_file = c_file
+	c2v.out = code_buffer{}
+	c2v.labels = map[string]string{}
+	c2v.errors = nil
 
-	if c2v.is_wrapper {
-		// unsupported by cgogo
-	} else {
-		// TODO out file
-		//c2v.out_file = os.create(c2v.outv)
-	}
-	c2v.genln("[translated]")
-	// Predeclared identifiers
-	if !c2v.is_wrapper {
-		c2v.genln("module main\n")
-	} else if c2v.is_wrapper {
-		c2v.genln("module ${c2v.wrapper_module_name}\n")
-	}
+	// c2v.out_file is created by save(), once the whole file has been translated.
+	// The file header (module/package clause) is generated by save() too.
 
 	// Convert Clang JSON AST nodes to C2V's nodes with extra info. Skip nodes from libc.
 	set_kind_enum(c2v.tree)
@@ -371,13 +357,7 @@ func (c2v *C2V) add_file(ast_path string, outv string, c_file string) {
 		//}
 		vprintf("ADDED TOP NODE line_i=%v\n", c2v.line_i)
 	}
-	if len(c2v.unhandled_nodes) > 0 {
-		vprintln("GOT SOME UNHANDLED NODES:")
-		for _, s := range c2v.unhandled_nodes {
-			vprintln(s)
-		}
-		panic("Unknown error")
-	}
+	return nil
 }
 
 func line_is_source(val string) bool {
@@ -389,21 +369,25 @@ func (c *C2V) func_call(node *Node) {
 	c.expr(expr) // this is `func_name(`
 	// Clean up macos builtin func names
 	// $if macos
-	is_memcpy := contains_substr(c.cur_out_line, "__builtin___memcpy_chk")
-	is_memmove := contains_substr(c.cur_out_line, "__builtin___memmove_chk")
-	is_memset := contains_substr(c.cur_out_line, "__builtin___memset_chk")
+	cur_line := c.out.current_line()
+	is_memcpy := contains_substr(cur_line, "__builtin___memcpy_chk")
+	is_memmove := contains_substr(cur_line, "__builtin___memmove_chk")
+	is_memset := contains_substr(cur_line, "__builtin___memset_chk")
 	if is_memcpy {
-		c.cur_out_line = replace_str(c.cur_out_line, "__builtin___memcpy_chk", "C.memcpy")
+		cur_line = replace_str(cur_line, "__builtin___memcpy_chk", "C.memcpy")
 	}
 	if is_memmove {
-		c.cur_out_line = replace_str(c.cur_out_line, "__builtin___memmove_chk", "C.memmove")
+		cur_line = replace_str(cur_line, "__builtin___memmove_chk", "C.memmove")
 	}
 	if is_memset {
-		c.cur_out_line = replace_str(c.cur_out_line, "__builtin___memset_chk", "C.memset")
+		cur_line = replace_str(cur_line, "__builtin___memset_chk", "C.memset")
+	}
+	if contains_substr(cur_line, "memset") && !contains_substr(cur_line, "C.memset(") {
+		vprintf("!! %v\n", cur_line)
+		cur_line = replace_str(cur_line, "memset(", "C.memset(")
 	}
-	if contains_substr(c.cur_out_line, "memset") {
-		vprintf("!! %v\n", c.cur_out_line)
-		c.cur_out_line = replace_str(c.cur_out_line, "memset(", "C.memset(")
+	if cur_line != c.out.current_line() {
+		c.out.set_current_line(cur_line)
 	}
 	// Drop last argument if we have memcpy_chk
 	is_m := is_memcpy || is_memmove || is_memset
@@ -432,8 +416,12 @@ func to_lower(s string) string {
 	return strings.ToLower(s)
 }
 
+// `user_t` => `User_t`
 func capitalize(s string) string {
-	return strings.ToUpper(s) // ??
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
 }
 
 func index(s, part string) int {
@@ -453,11 +441,7 @@ func trim_space(s string) string {
 }
 
 func join_strs(arr []string, deli string) string {
-	s := ""
-	for _, v := range arr {
-		s += v + deli
-	}
-	return s
+	return strings.Join(arr, deli)
 }
 
 func (c *C2V) func_decl(node *Node, gen_types string) {
@@ -472,19 +456,6 @@ func (c *C2V) func_decl(node *Node, gen_types string) {
 		// TODO tmp doom hack
 		return
 	}
-	// No statements - it"s a function declration, skip it
-	var no_stmts bool
-	if !node.has_child_of_kind(compound_stmt) {
-		no_stmts = true
-	} else {
-		no_stmts = false
-	}
-
-	vprintf("no_stmts: %v\n", no_stmts)
-	for _, child := range node.inner {
-		s := fmt.Sprintf("INNER: %d %s", child.kind, child.kind_str)
-		vprintln(s)
-	}
 	// Skip C++ tmpl args
 	if node.has_child_of_kind(template_argument) {
 		cnt := node.count_children_of_kind(template_argument)
@@ -496,361 +467,127 @@ func (c *C2V) func_decl(node *Node, gen_types string) {
 	if (name == "invalid") || (name == "referenced") {
 		return
 	}
+	if c.is_wrapper && (node.class_modifier == "static" || starts_with(name, "_")) {
+		// only the public API of the header is wrapped
+		c.skip(node, "private")
+		return
+	}
 	if !c.contains_word(name) {
-		vprintln("RRRR ${name} not here, skipping")
+		vprintf("RRRR %s not here, skipping\n", name)
+		c.skip(node, "not in file")
 		// This func is not found in current .c file, means that it was only
 		// in the include file, so it"s declared and used in some other .c file,
 		// no need to genenerate it here.
 		// TODO perf right now this searches an entire .c file for each global.
 		return
 	}
-	if contains_substr(node.ast_type.qualified, "...)") {
-		// TODO handle this better (`...any` ?)
-		c.genln("[c2v_variadic]")
-	}
-	if contains_substr(name, "blkcpy") {
-		vprintln("GOT FINISH")
-	}
-	if c.is_wrapper {
-		// unsupported
-	}
 	c.fns = append(c.fns, name)
-	typ := trim_space(before(node.ast_type.qualified, "("))
-	if typ == "void" {
-		typ = ""
-	} else {
-		typ = convert_type(typ).name
-	}
-	if contains_substr(typ, "...") {
-		c.gen("F")
-	}
 	if name == "main" {
 		c.inside_main = true
-		typ = ""
-	}
-	if true || contains_substr(name, "Vile") {
-		vprintln("\nFN DECL name=" + name + " typ=" + typ + "")
 	}
-
-	// Build func args
-	params := c.func_params(node)
-
-	str_args := ""
-	if name == "main" {
-		str_args = ""
-	} else {
-		str_args = join_strs(params, ", ")
+	fn := &FuncDecl{
+		name:        name,
+		c_name:      name + gen_types,
+		ret:         trim_space(before(node.ast_type.qualified, "(")),
+		is_variadic: contains_substr(node.ast_type.qualified, "...)"),
 	}
-	if !no_stmts || c.is_wrapper {
-		c_name := name + gen_types
-		if c.is_wrapper {
-			//c.genln("func C.${c_name}(${str_args}) ${typ}\n")
-		}
-		v_name := to_lower(name)
-		if v_name != c_name && !c.is_wrapper {
-			c.genln(`[c:"${c_name}"]`)
-		}
-		if c.is_wrapper {
-		} else {
-			s := fmt.Sprintf("func %s(%s) %s {", v_name, str_args, typ)
-			c.genln(s)
-		}
-
-		if !c.is_wrapper {
-			// For wrapper generation just generate function definitions without bodies
-			stmts := node.try_get_next_child_of_kind(compound_stmt)
-
-			c.statements(stmts)
-		} else if c.is_wrapper {
-		}
-	} else {
-		lower := to_lower(name)
-		if lower != name {
-			// This fixes unknown symbols errors when building separate .c => .v files into .o files
-			// example:
-			//
-			// [c: "P_TryMove"]
-			// func p_trymove(thing &Mobj_t, x int, y int) bool
-			//
-			// Now every time `p_trymove` is called, `P_TryMove` will be generated instead.
-			c.genln(`[c:"${name}"]`)
-		}
-		name = lower
-		c.genln("func ${name}(${str_args}) ${typ}")
+	for _, param := range node.find_children(parm_var_decl) {
+		fn.params = append(fn.params, Param{
+			name: param.name,
+			typ:  param.ast_type.qualified,
+		})
 	}
-	c.genln("")
-	vprintln("END OF FN DECL ast line=${c.line_i}")
-}
-
-func (c *C2V) func_params(node *Node) []string {
-	str_args := []string{}
-	nr_params := node.count_children_of_kind(parm_var_decl)
-	for i := 0; i < nr_params; i++ {
-		param := node.try_get_next_child_of_kind(parm_var_decl)
-
-		arg_typ := convert_type(param.ast_type.qualified)
-		if contains_substr(arg_typ.name, "...") {
-			vprintln("vararg: " + arg_typ.name)
-		}
-		param_name := to_lower(filter_name(param.name))
-		str_args = append(str_args, param_name+" "+arg_typ.name)
+	// No statements - it"s a function declaration
+	if stmts := node.find_children(compound_stmt); len(stmts) > 0 {
+		fn.body = stmts[0]
 	}
-	return str_args
+	vprintln("\nFN DECL name=" + name + " typ=" + fn.ret + "")
+	c.emitter.func_decl(fn)
+	c.report.Functions++
+	vprintf("END OF FN DECL ast line=%d\n", c.line_i)
 }
 
 // converts a C type to a V type
 func convert_type(typ_ string) Type {
-	typ := typ_
-	if true || contains_substr(typ, "type_t") {
-		vprintln(`\nconvert_type("${typ}")`)
-	}
-
-	if contains_substr(typ, "__va_list_tag *") {
+	vprintf("\nconvert_type(\"%s\")\n", typ_)
+	if contains_substr(typ_, "__va_list_tag *") {
 		return Type{
 			name: "va_list",
 		}
 	}
-	// TODO DOOM hack
-	typ = replace_str(typ, "fixed_t", "int")
-
-	is_const := contains_substr(typ, "const ")
-	if is_const {
-	}
-	typ = replace_str(typ, "const ", "")
-	typ = replace_str(typ, "volatile ", "")
-	typ = replace_str(typ, "std::", "")
-	if typ == "char **" {
+	typ := typ_
+	ctype, err := parse_ctype(typ)
+	if err != nil {
+		vprintln(err.Error())
 		return Type{
-			name: "&&u8",
+			name:     trim_space(typ),
+			is_const: contains_substr(typ, "const "),
 		}
 	}
-	if typ == "void *" {
-		return Type{
-			name: "voidptr",
+	name := v_type_name(ctype)
+	vprintf("\"%s\" => \"%s\"\n", typ_, name)
+	return Type{
+		name:     name,
+		is_const: ctype.has_const(),
+	}
+}
+
+// `char **` => `&&u8`, `int (*)(void *, int)` => `fn (voidptr, int) int`
+func v_type_name(t *CType) string {
+	switch t.kind {
+	case ctype_pointer:
+		if t.elem.is_void() {
+			return "voidptr"
 		}
-	} else if typ == "void **" {
-		return Type{
-			name: "&voidptr",
+		if t.elem.kind == ctype_func {
+			// V fn types are pointers already
+			return v_type_name(t.elem)
 		}
-	} else if starts_with(typ, "void *[") {
-		return Type{
-			name: "[" + sub_str(typ, len("void *["), len(typ)-1) + "]voidptr",
+		return "&" + v_type_name(t.elem)
+	case ctype_array:
+		return "[" + t.size + "]" + v_type_name(t.elem)
+	case ctype_func:
+		params := []string{}
+		for _, param := range t.params {
+			params = append(params, v_type_name(param))
 		}
-	}
-
-	// enum
-	if starts_with(typ, "enum ") {
-		return Type{
-			name:     capitalize(sub_str(typ, len("enum "), len(typ))),
-			is_const: is_const,
+		s := "fn (" + strings.Join(params, ", ") + ")"
+		if !t.elem.is_void() {
+			s += " " + v_type_name(t.elem)
 		}
-	}
-
-	// int[3]
-	idx := ""
-	if contains_substr(typ, "[") && contains_substr(typ, "]") {
-		if true {
-			pos := index(typ, "[")
-			idx = typ[pos:]
-			typ = typ[:pos]
-		} else {
-			idx = after(typ, "[")
-			idx = "[" + idx
-			typ = before(typ, "[")
+		return s
+	case ctype_enum:
+		return capitalize(t.name)
+	case ctype_record, ctype_typedef:
+		// `leveldb::DB` => `DB`, `std::vector<int>` => `vector<int>`
+		name := t.name
+		if pos := strings.LastIndex(before(name, "<"), "::"); pos != -1 {
+			name = name[pos+2:]
 		}
-	}
-	// leveldb::DB
-	if contains_substr(typ, "::") {
-		typ = after(typ, "::")
-	} else if contains_substr(typ, ":") {
-		// boolean:boolean
-		typ = all_before(typ, ":")
-	}
-	typ = replace_str(typ, " void *", "voidptr")
-
-	// char*** => ***char
-	base := trim_space(typ)
-	base = strings.ReplaceAll(base, "struct ", "") //, "signed ", ""])???
-	if starts_with(base, "signed ") {
-		// "signed char" == "char", so just ignore "signed "
-		// TODO ???
-		//base = base["signed ".len..]
-	}
-	if ends_with(base, "*") {
-		base = before(base, " *")
-	}
-
-	/*
-		// TODO ???
-		base = match base {
-			"long long" {
-				"i64"
-			}
-			"long" {
-				"int"
-			}
-			"unsigned int" {
-				"u32"
-			}
-			"unsigned long long" {
-				"i64"
-			}
-			"unsigned long" {
-				"u32"
-			}
-			"unsigned char" {
-				"u8"
-			}
-			"*unsigned char" {
-				"&u8"
-			}
-			"unsigned short" {
-				"u16"
-			}
-			"uint32_t" {
-				"u32"
-			}
-			"int32_t" {
-				"int"
-			}
-			"uint64_t" {
-				"u64"
-			}
-			"int64_t" {
-				"i64"
-			}
-			"int16_t" {
-				"i16"
-			}
-			"uint8_t" {
-				"u8"
-			}
-			"__int64_t" {
-				"i64"
-			}
-			"__int32_t" {
-				"int"
-			}
-			"__uint32_t" {
-				"u32"
-			}
-			"__uint64_t" {
-				"u64"
-			}
-			"short" {
-				"i16"
-			}
-			"char" {
-				"i8"
-			}
-			"float" {
-				"f32"
-			}
-			"double" {
-				"f64"
-			}
-			"byte" {
-				"u8"
-			}
-			//  just to avoid capitalizing these:
-			"int" {
-				"int"
-			}
-			"voidptr" {
-				"voidptr"
-			}
-			"intptr_t" {
-				"C.intptr_t"
-			}
-			"void" {
-				"void"
-			}
-			"u32" {
-				"u32"
-			}
-			"size_t" {
-				"usize"
-			}
-			"ptrdiff_t" {
-				"isize"
-			}
-			"boolean", "_Bool", "Bool", "bool (int)", "bool" {
-				"bool"
-			}
-			"FILE" {
-				"C.FILE"
-			}
-			else {
-				trim_underscores(base.capitalize())
-			}
+		if prim, ok := c_primitive(name); ok && t.kind == ctype_typedef {
+			return v_primitive(prim)
 		}
-	*/
-	amps := ""
-
-	if ends_with(typ, "*") {
-		star_pos := index(typ, "*")
-
-		nr_stars := len(typ[star_pos:])
-		amps = repeat(`&`, nr_stars)
-		typ = amps + base
-	} else if contains_substr(typ, "(*)") {
-		// func type
-		// int (*)(void *, int, char **, char **)
-		// func (voidptr, int, *byteptr, *byteptr) int
-		ret_typ := convert_type(all_before(typ, "("))
-		s := "func ("
-		// move func to the right place
-		typ = replace_str(typ, "(*)", " ")
-		// handle each arg
-		sargs := find_between(typ, "(", ")")
-		args := split(sargs, ",")
-		for i, arg := range args {
-			t := convert_type(arg)
-			s += t.name
-			if i < len(args)-1 {
-				s += ", "
-			}
+		if name == "FILE" {
+			return "C.FILE"
 		}
-		// Function doesn't return anything
-		if ret_typ.name == "void" {
-			typ = s + ")"
-		} else {
-			typ = "${s}) ${ret_typ.name}"
+		if is_anon_type_name(name) || name == "va_list" || starts_with(name, "vector<") {
+			return name
 		}
-		// C allows having func(void) instead of func()
-		typ = replace_str(typ, "(void)", "()")
-	} else {
-		typ = base
-	}
-	// User & => &User
-	if ends_with(typ, " &") {
-		typ = typ[:len(typ)-2]
-		base = typ
-		typ = "&" + typ
-	}
-	typ = trim_space(typ)
-	if contains_substr(typ, "&& ") {
-		typ = replace_str(typ, " ", "")
-	}
-	if contains_substr(typ, " ") {
-	}
-	vprintln(`"${typ_}" => "${typ}" base="${base}"`)
-
-	name := idx + typ
-	return Type{
-		name:     name,
-		is_const: is_const,
+		return trim_underscores(capitalize(name))
 	}
+	prim, _ := c_primitive(t.name)
+	return v_primitive(prim)
 }
 
 // |-RecordDecl 0x7fd7c302c560 <a.c:3:1, line:5:1> line:3:8 struct User definition
 func (c *C2V) record_decl(node *Node) {
-	vprintln(`record_decl("${node.name}")`)
+	vprintf("record_decl(%q)\n", node.name)
 	// Skip empty structs (extern or forward decls)
 	if node.kindof(record_decl) && len(node.inner) == 0 {
 		return
 	}
 	name := node.name
+	is_typedef := false
 	// Dont generate struct header if it was already generated by typedef
 	// Confusing, but typedefs in C AST are really messy.
 	// ...
@@ -866,6 +603,7 @@ func (c *C2V) record_decl(node *Node) {
 			}
 
 			name = next_node.name
+			is_typedef = true
 
 			if contains_substr(name, "apthing_t") {
 				vprintln(node.str())
@@ -876,64 +614,48 @@ func (c *C2V) record_decl(node *Node) {
 	if in_builtin_type_names(name) {
 		return
 	}
+	if c.is_wrapper && starts_with(name, "_") {
+		c.skip(node, "private")
+		return
+	}
 	if c.is_verbose {
-		c.genln(`// struct decl name="${name}"`)
+		c.genln(fmt.Sprintf(`// struct decl name="%s"`, name))
 	}
-	if c.in_c_types(name) {
+	if (name != "struct") && (name != "union") && !c.proj.add_type(c.out_dir(), name) {
 		return
 	}
-	if (name != "struct") && (name != "union") {
-		c.types = append(c.types, name)
-		name = capitalize_type(name)
-		if contains_substr(node.tags, "union") {
-			c.genln("union ${name} { ")
-		} else {
-			c.genln("struct ${name} { ")
-		}
+	s := &StructDecl{
+		name:       name,
+		is_union:   contains_substr(node.tags, "union"),
+		is_typedef: is_typedef,
 	}
 	for _, field := range node.inner {
-		// There may be comments, skip them
+		// FullComment nodes, the comments are taken from the source
 		if field.kind != field_decl {
 			continue
 		}
-		field_type := convert_type(field.ast_type.qualified)
-		field_name := filter_name(field.name)
-		if contains(field_type.name, "anonymous at") {
+		if contains(field.ast_type.qualified, "anonymous at") {
 			continue
 		}
-		/*
-			if field_type.name.contains("union") {
-				continue // TODO
-			}
-		*/
-		if ends_with(field_type.name, "_s") { // TODO doom _t _s hack, remove
-			n := field_type.name[:len(field_type.name)-2] + "_t"
-			c.genln(fmt.Sprintf("\t%s %s", field_name, n))
-		} else {
-			c.genln(fmt.Sprintf("\t%s %s", field_name, field_type.name))
-		}
+		doc, comment := c.member_comments(field)
+		s.fields = append(s.fields, Param{
+			name:    field.name,
+			typ:     field.ast_type.qualified,
+			doc:     doc,
+			comment: comment,
+		})
 	}
-	c.genln("}")
+	c.skip_comments_of(node)
+	c.emitter.struct_decl(s)
+	c.report.Structs++
 }
 
 func (c *C2V) in_c_types(s string) bool {
-	for _, v := range c.types {
-		if v == s {
-			return true
-		}
-	}
-
-	return false
+	return c.proj.has_type(c.out_dir(), s)
 }
 
 func (c *C2V) in_c_enums(s string) bool {
-	for _, v := range c.enums {
-		if v == s {
-			return true
-		}
-	}
-
-	return false
+	return c.proj.has_enum(c.out_dir(), s)
 }
 
 // Typedef node goes after struct enum, but we need to parse it first, so that "type name { " is
@@ -944,7 +666,7 @@ func (c *C2V) typedef_decl(node *Node) {
 	// typedef sha1_context_t sha1_context_s ;
 	// typedef after enum decl, just generate "enum NAME {" header
 	alias_name := node.name // get_val(-2)
-	vprintln(`TYPEDEF "${node.name}" ${node.is_builtin_type} ${typ}`)
+	vprintf("TYPEDEF %q %v %s\n", node.name, node.is_builtin_type, typ)
 	if contains(alias_name, "et_context_t") {
 		// TODO remove this
 		return
@@ -952,37 +674,24 @@ func (c *C2V) typedef_decl(node *Node) {
 	if in_builtin_type_names(node.name) {
 		return
 	}
+	if c.is_wrapper && starts_with(alias_name, "_") {
+		c.skip(node, "private")
+		return
+	}
 	if !contains(typ, alias_name) {
-		if contains(typ, "(*)") {
-			tt := convert_type(typ)
-			typ = tt.name
-		} else {
+		if !contains(typ, "(*)") {
 			// Struct types have junk before spaces
 			alias_name = all_after(alias_name, " ")
-			tt := convert_type(typ)
-			typ = tt.name
 		}
 		if starts_with(alias_name, "__") {
 			// Skip internal stuff like __builtin_ms_va_list
 			return
 		}
-		if c.in_c_types(alias_name) || c.in_c_enums(alias_name) {
+		if c.in_c_enums(alias_name) || !c.proj.add_type(c.out_dir(), alias_name) {
 			// This means that this is a struct/enum typedef that has already been defined.
 			return
 		}
-		if c.in_c_enums(typ) {
-			return
-		}
-		c.types = append(c.types, alias_name)
-		cgen_alias := typ
-		if starts_with(cgen_alias, "_") {
-			cgen_alias = trim_underscores(typ)
-		}
-		if !is_ptr_size(typ) && !starts_with(typ, "func (") {
-			// TODO handle this better
-			cgen_alias = capitalize(cgen_alias)
-		}
-		c.genln("type ${alias_name.capitalize()} = ${cgen_alias}") // typedef alias (SINGLE LINE)")
+		c.emitter.typedef_decl(alias_name, typ)
 		return
 	}
 	if contains(typ, "enum ") {
@@ -1023,13 +732,7 @@ func (c *C2V) parse_next_typedef() bool {
 }
 
 func (c *C2V) in_consts(s string) bool {
-	for _, v := range c.consts {
-		if v == s {
-			return true
-		}
-	}
-
-	return false
+	return c.proj.has_const(c.out_dir(), s)
 }
 
 func (c *C2V) enum_decl(node *Node) {
@@ -1041,67 +744,37 @@ func (c *C2V) enum_decl(node *Node) {
 			enum_name = next_node.name
 		}
 	}
-	if enum_name == "boolean" {
+	if _, ok := type_overrides[enum_name]; ok {
+		// `[types] boolean = "bool"`
 		return
 	}
-	if enum_name == "" {
-		// empty enum means it"s just a list of #define"ed consts
-		c.genln("\nconst ( // empty enum")
-	} else {
-		enum_name = replace_str(capitalize(enum_name), "Enum ", "")
-		if c.in_c_enums(enum_name) {
-			return
-		}
-
-		c.genln("enum ${enum_name} {")
-	}
-	vals := c.enum_vals[enum_name]
-	for i, child := range node.inner {
-		name := filter_name(to_lower(child.name))
-		vals.add(name)
-		has_anon_generated := false
-		// empty enum means it"s just a list of #define"ed consts
-		if enum_name == "" {
-			if !starts_with(name, "_") && c.in_consts(name) {
-				c.consts = append(c.consts, name)
-				c.gen("\t${name}")
-				has_anon_generated = true
-			}
-		} else {
-			c.gen("\t" + name)
+	en := &EnumDecl{name: enum_name}
+	for _, child := range node.inner {
+		if child.kind != enum_constant_decl {
+			continue
 		}
-		// handle custom enum vals, e.g. `MF_SHOOTABLE = 4`
-		if len(child.inner) > 0 {
-			const_expr := child.try_get_next_child()
-			if const_expr.kind == constant_expr {
-				c.gen(" = ")
-				c.skip_parens = true
-				c.expr(const_expr.try_get_next_child())
-				c.skip_parens = false
-			}
-		} else if has_anon_generated {
-			c.genln(fmt.Sprintf(" = %d", i))
+		val := EnumVal{name: child.name}
+		// custom enum vals, e.g. `MF_SHOOTABLE = 4`
+		if len(child.inner) > 0 && child.inner[0].kind == constant_expr && len(child.inner[0].inner) > 0 {
+			val.value = child.inner[0].inner[0]
 		}
+		val.doc, val.comment = c.member_comments(child)
+		en.vals = append(en.vals, val)
 	}
-	if enum_name != "" {
-		vprintln(`decl enum "${enum_name}" with ${vals.len} vals`)
-		c.enum_vals[enum_name] = vals
-		c.genln("}\n")
-	} else {
-		c.genln(")\n")
-	}
-	if enum_name != "" {
-		c.enums = append(c.enums, enum_name)
+	c.skip_comments_of(node)
+	if c.emitter.enum_decl(en) {
+		c.report.Enums++
 	}
 }
 
 func (c *C2V) statements(compound_stmt *Node) {
-	c.indent++
+	c.out.indent++
 	// Each CompoundStmt"s child is a statement
 	for i, _ := range compound_stmt.inner {
 		c.statement(compound_stmt.inner[i])
 	}
-	c.indent--
+	c.gen_comments_until(compound_stmt)
+	c.out.indent--
 	c.genln("}")
 }
 
@@ -1112,6 +785,10 @@ func (c *C2V) statements_no_rcbr(compound_stmt *Node) {
 }
 
 func (c *C2V) statement(child *Node) {
+	c.gen_comments(child)
+	if c.emitter.stmt(child) {
+		return
+	}
 	if child.kindof(decl_stmt) {
 		c.var_decl(child)
 		c.genln("")
@@ -1126,8 +803,6 @@ func (c *C2V) statement(child *Node) {
 		c.for_st(child)
 	} else if child.kindof(do_stmt) {
 		c.do_st(child)
-	} else if child.kindof(switch_stmt) {
-		c.switch_st(child)
 	} else if child.kindof(compound_stmt) {
 		// Just  { }
 		c.genln("{")
@@ -1139,7 +814,6 @@ func (c *C2V) statement(child *Node) {
 	} else if child.kindof(label_stmt) {
 		label := child.name // child.get_val(-1)
 		c.labels[child.name] = child.declaration_id
-		c.genln("/*RRRREG ${child.name} id=${child.declaration_id} */")
 		c.genln(fmt.Sprintf("%s: ", label))
 		c.statements_no_rcbr(child)
 	} else if child.kindof(cxx_for_range_stmt) {
@@ -1156,7 +830,7 @@ func (c *C2V) goto_stmt(node *Node) {
 	if label == "" {
 		label = "_GOTO_PLACEHOLDER_" + node.label_id
 	}
-	c.genln("goto ${label} /* id: ${node.label_id} */")
+	c.genln("goto " + label)
 }
 
 func (c *C2V) return_st(node *Node) {
@@ -1189,6 +863,11 @@ func (c *C2V) if_statement(node *Node) {
 	}
 	// Optional else block
 	else_st := node.try_get_next_child()
+	if !else_st.kindof(bad) && !else_st.kindof(null0) {
+		// `}\nelse {` is a syntax error in Go
+		c.out.join_lines()
+		c.gen(" ")
+	}
 	if else_st.kindof(compound_stmt) || else_st.kindof(return_stmt) {
 		c.genln("else {")
 		c.st_block_no_start(else_st)
@@ -1231,7 +910,9 @@ func (c *C2V) for_st(node *Node) {
 		// second cond can be Null
 		expr2 = node.try_get_next_child()
 	}
-	c.expr(expr2)
+	if expr2.kind_str != "" {
+		c.gen_bool(expr2)
+	}
 	c.gen(" ; ")
 	expr3 := node.try_get_next_child()
 	c.expr(expr3)
@@ -1248,179 +929,11 @@ func (c *C2V) do_st(node *Node) {
 	c.genln("// while()")
 	c.gen("if ! (")
 	expr := node.try_get_next_child()
-	c.expr(expr)
+	c.gen_bool(expr)
 	c.genln(" ) { break }")
 	c.genln("}")
 }
 
-func (c *C2V) case_st(child *Node, is_enum bool) bool {
-	if child.kindof(case_stmt) {
-		if is_enum {
-			// Force short `.val {` enum syntax, but only in `case .val:`
-			// Later on it"ll be set to false, so that full syntax is used (`Enum.val`)
-			// Since enums are often used as ints, and V will need the full enum
-			// value to convert it to ints correctly.
-			c.inside_switch_enum = true
-		}
-		c.gen(" ")
-		case_expr := child.try_get_next_child()
-		c.expr(case_expr)
-		a := child.try_get_next_child()
-		if a.kindof(null0) {
-			a = child.try_get_next_child()
-		}
-		vprintln("A TYP=${a.ast_type}")
-		if a.kindof(compound_stmt) {
-			c.genln("// case comp stmt")
-			c.statements(a)
-		} else if a.kindof(case_stmt) {
-			// case 1:
-			// case 2:
-			// case 3:
-			// ===>
-			// case 1, 2, 3:
-			for a.kindof(case_stmt) {
-				e := a.try_get_next_child()
-				c.gen(", ")
-				c.expr(e) // this is `1` in `case 1:`
-				tmp := a.try_get_next_child()
-				if tmp.kindof(null0) {
-					tmp = a.try_get_next_child()
-				}
-				a = tmp
-			}
-			c.genln("{")
-			vprintln("!!!!!!!!caseexpr=")
-			c.inside_switch_enum = false
-			c.statement(a)
-		} else if a.kindof(default_stmt) {
-		} else {
-			// case body
-			c.inside_switch_enum = false
-			c.genln("// case comp body kind=${a.kind} is_enum=${is_enum} ")
-			c.genln("{")
-			c.statement(a)
-			if a.kindof(return_stmt) {
-			} else if a.kindof(break_stmt) {
-				return true
-			}
-			if is_enum {
-				c.inside_switch_enum = true
-			}
-		}
-	}
-	return false
-}
-
-// Switch statements are a mess in C...
-func (c *C2V) switch_st(switch_node *Node) {
-	c.gen("match ")
-	c.inside_switch++
-	expr := switch_node.try_get_next_child()
-	is_enum := false
-	if len(expr.inner) > 0 {
-		// 0
-		x := expr.inner[0]
-		if x.ast_type.qualified == "int" {
-			// this is an int, not a C enum type
-			c.inside_switch_enum = false
-		} else {
-			c.inside_switch_enum = true
-			is_enum = true
-		}
-	}
-	comp_stmt := switch_node.try_get_next_child()
-	// Detect if this switch statement runs on an enum (have to look at the first
-	// value being compared). This means that the integer will have to be cast to this enum
-	// in V.
-	// switch (x) { case enum_val: ... }   ==>
-	// match MyEnum(x) { .enum_val { ... } }
-	// Don't cast if it"s already an enum and not an int. Enum(enum) compiles, but still.
-	second_par := false
-	if len(comp_stmt.inner) > 0 {
-		child := comp_stmt.inner[0]
-		if child.kindof(case_stmt) {
-			case_expr := child.try_get_next_child()
-			if case_expr.kindof(constant_expr) {
-				x := case_expr.try_get_next_child()
-				vprintln("YEP")
-
-				if x.ref_declaration.kind == enum_constant_decl {
-					is_enum = true
-					c.inside_switch_enum = true
-					c.gen(c.enum_val_to_enum_name(x.ref_declaration.name))
-
-					c.gen("(")
-					second_par = true
-				}
-			}
-		}
-	}
-	// Now the opposite. Detect if the switch runs on a C int which is an enum in V.
-	// switch (x) { case enum_val: ... }   ==>
-	// match (x) { int(.enum_val) { ... } }
-
-	//
-	c.expr(expr)
-	if is_enum {
-	}
-	if second_par {
-		c.gen(")")
-	}
-	// c.inside_switch_enum = false
-	c.genln(" {")
-	default_node := new(Node)
-	got_else := false
-	// Switch AST node is weird. First child is a CaseStmt that contains a single child
-	// statement (the first in the block). All other statements in the block are siblings
-	// of this CaseStmt:
-	// switch (x) {
-	//   case 1:
-	//     line1(); // child of CaseStmt
-	//     line2(); // CallExpr (sibling of CaseStmt)
-	//     line3(); // CallExpr (sibling of CaseStmt)
-	// }
-	has_case := false
-	for i, child := range comp_stmt.inner {
-		if child.kindof(case_stmt) {
-			if i > 0 && has_case {
-				c.genln("}")
-			}
-			c.case_st(child, is_enum)
-			has_case = true
-		} else if child.kindof(default_stmt) {
-			default_node = child.try_get_next_child()
-			got_else = true
-		} else {
-			// handle weird children-siblings
-			c.inside_switch_enum = false
-			c.statement(child)
-		}
-	}
-	if got_else {
-		if default_node.kind != bad {
-			if default_node.kindof(case_stmt) {
-				c.case_st(default_node, is_enum)
-				c.genln("}")
-				c.genln("else {")
-			} else {
-				c.genln("}")
-				c.genln("else {")
-				c.statement(default_node)
-			}
-			c.genln("}")
-		}
-	} else {
-		if has_case {
-			c.genln("}")
-		}
-		c.genln("else{}")
-	}
-	c.genln("}")
-	c.inside_switch--
-	c.inside_switch_enum = false
-}
-
 func (c *C2V) st_block_no_start(node *Node) {
 	c.st_block2(node, false)
 }
@@ -1443,112 +956,38 @@ func (c *C2V) st_block2(node *Node, insert_start bool) {
 	}
 }
 
-//
 func (c *C2V) gen_bool(node *Node) {
-	typ := c.expr(node)
-	if typ == "int" {
-	}
+	c.emitter.gen_bool(node)
 }
 
 func (c *C2V) var_decl(decl_stmt *Node) {
+	// `extern int x, y;` is a single stub and a single error
+	externs := []string{}
+	for _, child := range decl_stmt.inner {
+		if child.kindof(var_decl) && child.class_modifier == "extern" {
+			externs = append(externs, "`"+child.name+"`")
+		}
+	}
+	if len(externs) > 0 {
+		msg := fmt.Sprintf("local extern variable %s is not supported yet", externs[0])
+		if len(externs) > 1 {
+			msg = fmt.Sprintf("local extern variables %s are not supported yet", strings.Join(externs, ", "))
+		}
+		c.add_error(decl_stmt.inner[0], msg)
+		c.stub(decl_stmt)
+		return
+	}
 	for i := 0; i < len(decl_stmt.inner); i++ {
-		//for _, _ := range decl_stmt.inner {
 		var_decl := decl_stmt.try_get_next_child()
 		if var_decl.kindof(record_decl) || var_decl.kindof(enum_decl) {
 			return
 		}
-		if var_decl.class_modifier == "extern" {
-			vprintln("local extern vars are not supported yet: ")
-			vprintln(var_decl.str())
-			vprintln(c.cur_file + ":" + fmt.Sprintf("%d", c.line_i))
-			panic(1)
-			return
-		}
 		// cinit means we have an initialization together with var declaration:
 		// `int a = 0;`
 		cinit := var_decl.initialization_type == "c"
-		name := to_lower(filter_name(var_decl.name))
-		typ_ := convert_type(var_decl.ast_type.qualified)
-		if typ_.is_static {
-			c.gen("static ")
-		}
-		if cinit {
-			expr := var_decl.try_get_next_child()
-			c.gen(fmt.Sprintf("%s := ", name))
-			c.expr(expr)
-			if len(decl_stmt.inner) > 1 {
-				c.gen("\n")
-			}
-		} else {
-			oldtyp := var_decl.ast_type.qualified
-			typ := typ_.name
-			vprintln(`oldtyp="${oldtyp}" typ="${typ}"`)
-			// set default zero value (V requires initialization)
-			def := ""
-			if starts_with(var_decl.ast_type.desugared_qualified, "struct ") {
-				def = "${typ}{}" // `struct Foo foo;` => `foo := Foo{}` (empty struct init)
-			} else if typ == "u8" {
-				def = "u8(0)"
-			} else if typ == "u16" {
-				def = "u16(0)"
-			} else if typ == "u32" {
-				def = "u32(0)"
-			} else if typ == "u64" {
-				def = "u64(0)"
-			} else if (typ == "size_t") || (typ == "usize") {
-				def = "usize(0)"
-			} else if typ == "i8" {
-				def = "i8(0)"
-			} else if typ == "i16" {
-				def = "i16(0)"
-			} else if typ == "int" {
-				def = "0"
-			} else if typ == "i64" {
-				def = "i64(0)"
-			} else if (typ == "ptrdiff_t") || (typ == "isize") {
-				def = "isize(0)"
-			} else if typ == "bool" {
-				def = "false"
-			} else if typ == "f32" {
-				def = "f32(0.0)"
-			} else if typ == "f64" {
-				def = "0.0"
-			} else if typ == "boolean" {
-				def = "false"
-			} else if ends_with(oldtyp, "*") {
-				// *sqlite3_mutex ==>
-				// &sqlite3_mutex{!}
-				// println2("!!! $oldtyp $typ")
-				// def = "&${typ.right(1)}{!}"
-				var tt string
-				if starts_with(typ, "&") {
-					tt = typ[1:]
-				} else {
-					tt = typ
-				}
-				def = fmt.Sprintf("&%s(0)", tt)
-			} else if starts_with(typ, "[") {
-				// Empty array init
-				def = "${typ}{}"
-			} else {
-				// We assume that everything else is a struct, because C AST doesn't
-				// give us any info that typedef"ed structs are structs
-
-				if contains_any_substr(oldtyp, []string{"dirtype_t", "angle_t"}) { // TODO DOOM handle int aliases
-					def = "u32(0)"
-				} else {
-					def = "${typ}{}"
-				}
-			}
-			// vector<int> => int => []int
-			if starts_with(typ, "vector<") {
-				def = sub_str(typ, len("vector<"), len(typ)-1)
-				def = fmt.Sprintf("[]%s", def)
-			}
-			c.gen("${name} := ${def}")
-			if len(decl_stmt.inner) > 1 {
-				c.genln("")
-			}
+		c.emitter.var_decl(var_decl, cinit)
+		if len(decl_stmt.inner) > 1 {
+			c.genln("")
 		}
 	}
 }
@@ -1565,17 +1004,19 @@ func (c *C2V) global_var_decl(var_decl *Node) {
 	if starts_with(var_decl.ast_type.qualified, "[]") {
 		return
 	}
-	typ := convert_type(var_decl.ast_type.qualified)
-	existing, has := c.globals[var_decl.name]
+	typ := c.emitter.type_name(var_decl.ast_type.qualified)
+	existing, has := c.proj.global(c.out_dir(), var_decl.name)
 	if has {
-		if !types_are_equal(existing.typ, typ.name) {
-			c.verror(`Duplicate global "${var_decl.name}" with different types:"${existing.typ}" and	"${typ.name}".
+		if !types_are_equal(existing.typ, typ) {
+			c.add_error(var_decl, fmt.Sprintf(`duplicate global "%s" with different types "%s" and "%s".
 Since C projects do not use modules but header files, duplicate globals are allowed.
-This will not compile in V, so you will have to modify one of the globals and come up with a
-unique name`)
+This will not compile, so you will have to modify one of the globals and come up with a
+unique name`, var_decl.name, existing.typ, typ))
+			return
 		}
 		if !existing.is_extern {
-			c.genln(`// skipping global dup "${var_decl.name}"`)
+			c.genln(fmt.Sprintf(`// skipping global dup "%s"`, var_decl.name))
+			c.skip(var_decl, "duplicate global")
 			return
 		}
 	}
@@ -1587,22 +1028,17 @@ unique name`)
 		for _, x := range c.tree.inner {
 			if x.kindof(var_decl.kind) && (x.name == var_decl.name) && x.id != var_decl.id {
 				if len(x.inner) > 0 {
-					c.genln("// skipped extern global ${x.name}")
+					c.genln("// skipped extern global " + x.name)
+					c.skip(var_decl, "extern global initialized later")
 					return
 				}
 			}
 		}
 	}
-	// We assume that if the global"s type is `[N]array`, and it"s initialized,
-	// then it"s constant
-	is_fixed_array := contains(var_decl.ast_type.qualified, "]") &&
+	// Initialized constants and fixed arrays are generated in every file that has them
+	is_fixed_array := contains(var_decl.ast_type.qualified, "[") &&
 		contains(var_decl.ast_type.qualified, "]")
-	is_const := is_inited && (typ.is_const || is_fixed_array)
-	if true || !contains(typ.name, "[") {
-	}
-	if c.is_wrapper && starts_with(typ.name, "_") {
-		return
-	}
+	is_const := is_inited && (convert_type(var_decl.ast_type.qualified).is_const || is_fixed_array)
 	if c.is_wrapper {
 		return
 	}
@@ -1610,14 +1046,10 @@ unique name`)
 		// This is an extern global, and it"s declared later in the file without `extern`.
 		return
 	}
-	// Cut generated code from `c.out` to `c.globals_out`
-	start := len(c.out.arr.inner)
-	if is_const {
-		c.consts = append(c.consts, name)
-		c.gen(`[export:"${name}"]\nconst (\n${name}  `)
-	} else {
+	if !is_const {
 		if !c.contains_word(name) && !contains(c.cur_file, "deh_") { // TODO deh_ hack remove
 			vprintf("RRRR global %s not here, skipping\n", name)
+			c.skip(var_decl, "not in file")
 			// This global is not found in current .c file, means that it was only
 			// in the include file, so it"s declared and used in some other .c file,
 			// no need to genenerate it here.
@@ -1627,72 +1059,34 @@ unique name`)
 		if in_builtin_global_names(name) {
 			return
 		}
-
-		if is_inited {
-			c.gen("/*!*/[weak] __global ( ${name} ")
-		} else {
-			if contains(typ.name, "anonymous enum") || contains(typ.name, "unnamed enum") {
-				// Skip anon enums, they are declared as consts in V
-				return
-			}
-
-			if is_extern && is_fixed_array && var_decl.redeclarations_count == 0 {
-				c.gen("[c_extern]")
-			} else {
-				c.gen("[weak]")
-			}
-			c.gen("__global ( ${name} ${typ.name} ")
-		}
-		c.global_struct_init = typ.name
 	}
-	if is_fixed_array && contains(var_decl.ast_type.qualified, "[]") &&
-		!contains(var_decl.ast_type.qualified, "*") && !is_inited {
-		// Do not allow uninitialized fixed arrays for now, since they are not supported by V
-		eprintln(`${c.cur_file}: uninitialized fixed array without the size "${name}" typ="${var_decl.ast_type.qualified}"`)
-		panic(1)
+	g := &GlobalDecl{
+		name:      name,
+		typ:       var_decl.ast_type.qualified,
+		is_extern: is_extern,
+		node:      var_decl,
 	}
-
-	// if the global has children, that means it"s initialized, parse the expression
 	if is_inited {
-		child := var_decl.try_get_next_child()
-		c.gen(" = ")
-		is_struct := child.kindof(init_list_expr) && !is_fixed_array
-		needs_cast := !is_const && !is_struct // Don't generate `foo=Foo(Foo{` if it"s a struct init
-		if needs_cast {
-			c.gen(typ.name + " (") ///* typ=$typ   KIND= $child.kind isf=$is_fixed_array*/(")
-		}
-		c.expr(child)
-		if needs_cast {
-			c.gen(")")
-		}
-		c.genln("")
-	} else {
-		c.genln("\n")
-	}
-	if true {
-		c.genln(")\n")
+		g.init = var_decl.try_get_next_child()
 	}
+	// Cut generated code from `c.out` to `c.globals_out`
+	c.out.checkpoint("global")
+	c.emitter.global(g)
+	c.report.Globals++
+	s := ""
 	if c.is_dir {
-		s := c.out.cut_to(start)
-		c.globals_out[name] = s
+		s = c.out.cut_since("global")
 	}
-	c.global_struct_init = ""
-	c.globals[name] = &Global{
+	c.proj.add_global(c.out_dir(), &Global{
 		name:      name,
 		is_extern: is_extern,
-		typ:       typ.name,
-	}
+		typ:       typ,
+	}, s, c.is_dir)
 }
 
 // `"red"` => `"Color"`
 func (c *C2V) enum_val_to_enum_name(enum_val string) string {
-	filtered_enum_val := filter_name(enum_val)
-	for enum_name, vals := range c.enum_vals {
-		if vals.contains(filtered_enum_val) {
-			return enum_name
-		}
-	}
-	return ""
+	return c.proj.enum_name_of(c.out_dir(), filter_name(enum_val))
 }
 
 // expr is a spcial one. we dont know what type node has.
@@ -1703,6 +1097,13 @@ func (c *C2V) expr(_node *Node) string {
 	if node.kindof(null0) {
 		return ""
 	}
+	if m := c.macro_at(node); m != nil {
+		c.gen(c.emitter.macro_name(m.name))
+		return node.value
+	}
+	if c.emitter.expr(node) {
+		return node.value
+	}
 	if node.kindof(integer_literal) {
 		if c.returning_bool {
 			if node.value == "1" {
@@ -1714,9 +1115,8 @@ func (c *C2V) expr(_node *Node) string {
 			c.gen(node.value)
 		}
 	} else if node.kindof(character_literal) {
-		// "a"
-		//c.gen("`" + rune(node.value_number).str() + "`")
-		c.gen("`" + fmt.Sprintf("%c", node.value_number) + "`")
+		// 'a'
+		c.gen(fmt.Sprintf("%q", rune(node.value_number)))
 	} else if node.kindof(floating_literal) {
 		// 1e80
 		c.gen(node.value)
@@ -1724,15 +1124,13 @@ func (c *C2V) expr(_node *Node) string {
 		n := node.try_get_next_child()
 		c.expr(n)
 	} else if node.kindof(null_stmt) {
-		// null
-		c.gen("0 /* null */")
 	} else if node.kindof(cold_attr) {
 	} else if node.kindof(binary_operator) {
 		// = + - *
 		op := node.opcode
 		first_expr := node.try_get_next_child()
 		c.expr(first_expr)
-		c.gen(" ${op} ")
+		c.gen(fmt.Sprintf(" %s ", op))
 		second_expr := node.try_get_next_child()
 
 		if second_expr.kindof(binary_operator) && second_expr.opcode == "=" {
@@ -1766,15 +1164,10 @@ func (c *C2V) expr(_node *Node) string {
 		// ++ --
 		op := node.opcode
 		expr := node.try_get_next_child()
-		if (op == "--") || (op == "++") {
+		if node.is_postfix {
 			c.expr(expr)
-			c.gen(" ${op}")
-			if !c.inside_for && !node.is_postfix {
-				// prefix ++
-				// but do not generate `++i` in for loops, it breaks in V for some reason
-				c.gen("$")
-			}
-		} else if op == "-" || op == "&" || op == "*" || op == "!" || op == "~" {
+			c.gen(op)
+		} else if op == "-" || op == "&" || op == "*" || op == "!" || op == "~" || op == "++" || op == "--" {
 			c.gen(op)
 			c.expr(expr)
 		}
@@ -1797,15 +1190,7 @@ func (c *C2V) expr(_node *Node) string {
 		c.name_expr(node)
 	} else if node.kindof(string_literal) {
 		// "string literal"
-		str := node.value
-		// "a" => "a"
-		no_quotes := sub_str(str, 1, len(str)-1)
-		if contains(no_quotes, `"`) {
-			// same quoting logic as in vfmt
-			c.gen(`c"${no_quotes}"`)
-		} else {
-			c.gen(`c"${no_quotes}"`)
-		}
+		c.gen(node.value)
 	} else if node.kindof(call_expr) {
 		// func call
 		c.func_call(node)
@@ -1820,19 +1205,16 @@ func (c *C2V) expr(_node *Node) string {
 		} else {
 			field = filter_name(field)
 		}
-		c.gen(".${field}")
+		c.gen("." + field)
 	} else if node.kindof(unary_expr_or_type_trait_expr) {
 		// sizeof
-		c.gen("sizeof")
-		// sizeof (expr) ?
+		c.gen("sizeof(")
 		if len(node.inner) > 0 {
-			expr := node.try_get_next_child()
-			c.expr(expr)
+			c.expr(node.try_get_next_child())
 		} else {
-			// sizeof (Type) ?
-			typ := convert_type(node.ast_argument_type.qualified)
-			c.gen(fmt.Sprintf("(%v)", typ.name))
+			c.gen(c.emitter.type_name(node.ast_argument_type.qualified))
 		}
+		c.gen(")")
 	} else if node.kindof(array_subscript_expr) {
 		// a[0]
 		first_expr := node.try_get_next_child()
@@ -1851,30 +1233,20 @@ func (c *C2V) expr(_node *Node) string {
 		// (int*)a  => (int*)(a)
 		// CStyleCastExpr "const char **" <BitCast>
 		expr := node.try_get_next_child()
-		typ := convert_type(node.ast_type.qualified)
-		cast := typ.name
-		if contains(cast, "*") {
-			cast = "(${cast})"
-		}
-		c.gen("${cast}(")
+		c.gen("(" + c.emitter.type_name(node.ast_type.qualified) + ")(")
 		c.expr(expr)
 		c.gen(")")
 	} else if node.kindof(conditional_operator) {
 		// ? :
-		c.gen("if ") // { } else { }")
-		expr := node.try_get_next_child()
-		case1 := node.try_get_next_child()
-		case2 := node.try_get_next_child()
-		c.expr(expr)
-		c.gen("{ ")
-		c.expr(case1)
-		c.gen(" } else {")
-		c.expr(case2)
-		c.gen("}")
+		c.gen("(")
+		c.expr(node.try_get_next_child())
+		c.gen(" ? ")
+		c.expr(node.try_get_next_child())
+		c.gen(" : ")
+		c.expr(node.try_get_next_child())
+		c.gen(")")
 	} else if node.kindof(break_stmt) {
-		if c.inside_switch == 0 {
-			c.genln("break")
-		}
+		c.genln("break")
 	} else if node.kindof(continue_stmt) {
 		c.genln("continue")
 	} else if node.kindof(goto_stmt) {
@@ -1893,75 +1265,28 @@ func (c *C2V) expr(_node *Node) string {
 	} else if node.kindof(deprecated_attr) {
 		c.gen("/*deprecated*/")
 	} else if node.kindof(full_comment) {
-		c.gen("/*full comment*/")
+		// the comments are generated from the source, see comments.go
 	} else if node.kindof(bad) {
-		vprintln("BAD node in expr()")
-		vprintln(node.str())
+		c.warn(node, "bad node in expr()")
 	} else {
-		if node.is_builtin() {
-			// TODO this check shouldn't be needed, all builtin nodes should be skipped
-			// when handling top level nodes
+		// TODO this check shouldn't be needed, all builtin nodes should be skipped
+		// when handling top level nodes.
+		// Expressions have no `loc`, only a `range`, so is_builtin() is true for all of them.
+		if node.range0.begin.file == "" || line_is_builtin_header(node.range0.begin.file) ||
+			line_is_builtin_header(node.range0.begin.spelling_file.path) {
 			return node.value
 		}
-		eprintln(`\n\nUnhandled expr() node {${node.kind}} (ast line nr node.ast_line_nr "${c.cur_file}"):`)
-
-		eprintln(node.str())
-
-		//print_backtrace()
-		panic(1)
+		vprintln(node.str())
+		c.add_unhandled(node, "unhandled expression")
+		c.stub_expr(node)
+		return ""
 	}
 	return node.value // get_val(0)
 }
 
+// The default for emitters that keep C names as they are
 func (c *C2V) name_expr(node *Node) {
-	// `GREEN` => `Color.GREEN`
-	// Find the enum that has this value
-	// vals:
-	// ["int", "EnumConstant", "MT_SPAWNFIRE", "int"]
-	is_enum_val := node.ref_declaration.kind == enum_constant_decl
-
-	if is_enum_val {
-		enum_val := to_lower(node.ref_declaration.name)
-		need_full_enum := true // need `Color.green` instead of just `.green`
-
-		if c.inside_switch != 0 && c.inside_switch_enum {
-			// generate just `match ... { .val { } }`, not `match ... { Enum.val { } }`
-			need_full_enum = false
-		}
-		if c.inside_array_index {
-			need_full_enum = true
-		}
-		enum_name := c.enum_val_to_enum_name(enum_val)
-		if c.inside_array_index {
-			// `foo[ENUM_VAL]` => `foo(int(ENUM_NAME.ENUM_VAL))`
-			c.gen("int(")
-		}
-		if need_full_enum {
-			c.gen(enum_name)
-		}
-		if (enum_val != "true") && (enum_val != "false") && enum_name != "" {
-			// Don't add a `.` before "const" enum vals so that e.g. `tmbbox[BOXLEFT]`
-			// won't get translated to `tmbbox[.boxleft]`
-			// (empty enum name means its enum vals are consts)
-
-			c.gen(".")
-		}
-	}
-
-	name := node.ref_declaration.name
-
-	if !ArrayContains(name, c.consts) && !c.global_contains(name) {
-		// Functions and variables are all lowercase in V
-		name = to_lower(name)
-		if starts_with(name, "c.") {
-			name = "C." + name[2:] // TODO why is this needed?
-		}
-	}
-
-	c.gen(filter_name(name))
-	if is_enum_val && c.inside_array_index {
-		c.gen(")")
-	}
+	c.gen(filter_name(node.ref_declaration.name))
 }
 
 func ArrayContains(s string, arr []string) bool {
@@ -1974,58 +1299,24 @@ func ArrayContains(s string, arr []string) bool {
 	return false
 }
 
+// `{1, 2, 3}`, emitters that need a type before the list generate it themselves
 func (c *C2V) init_list_expr(node *Node) {
-	t := node.ast_type.qualified
-	// c.gen(" /* list init $t */ ")
-	// C list init can be an array (`numbers = {1,2,3}` => `numbers = [1,2,3]``)
-	// or a struct init (`user = {"Bob", 20}` => `user = {"Bob", 20}`)
-	is_arr := contains(t, "[")
-	if !is_arr {
-		c.genln(parse_c_struct_name(t) + " {")
-	} else {
-		c.gen("[")
-	}
+	children := node.inner
 	if len(node.array_filler) > 0 {
-		for i, child := range node.array_filler {
-			// array_filler nodes were not handled by set_kind_enum
-			child.initialize_node_and_children()
-
-			if child.kindof(implicit_value_init_expr) {
-			} else {
-				c.expr(child)
-				if i < len(node.array_filler)-1 {
-					c.gen(", ")
-				}
-			}
-		}
-	} else {
-		for i, child := range node.inner {
-			if child.kind == bad {
-				child.kind = convert_str_into_node_kind(child.kind_str) // array_filler nodes were not handled by set_kind_enum
-			}
-
-			// C allows not to set final fields (a = {1,2,,,,})
-			// V requires all fields to be set
-			if child.kindof(implicit_value_init_expr) {
-				c.gen("0/*IMPLICIT*/")
-			} else {
-				c.expr(child)
-				if i < len(node.inner)-1 {
-					c.gen(", ")
-				}
-			}
-		}
+		children = node.array_filler
 	}
-	is_fixed := contains(node.ast_type.qualified, "[") && contains(node.ast_type.qualified, "]")
-	if !is_arr {
-		c.genln("}")
-	} else {
-		if is_fixed {
-			c.genln("]!")
+	c.gen("{")
+	for i, child := range children {
+		if i > 0 {
+			c.gen(", ")
+		}
+		if child.kindof(implicit_value_init_expr) {
+			c.gen("0")
 		} else {
-			c.genln("]")
+			c.expr(child)
 		}
 	}
+	c.gen("}")
 }
 
 func filter_name(name string) string {
@@ -2047,49 +1338,92 @@ func filter_name(name string) string {
 
 func (c2v *C2V) translate_file(path string) {
 	start_ticks := time.Now()
-	print("  translating ${path:-15s} ... ")
-	//flush_stdout()
-	c2v.set_config_overrides_for_file(path)
-	lines := []string{}
+	c2v.report = &FileReport{Path: path}
+	defer func() {
+		c2v.report.DurationMs = time.Since(start_ticks).Milliseconds()
+		c2v.proj.add_report(c2v.report)
+	}()
+	c_file := path
 	ast_path := path
-	ext := filepath.Ext(path)
-	if contains(path, "/src/") {
-		// Hack to fix "doomtype.h" file not found
-		// TODO come up with a better solution
-		work_path := before(path, "/src/") + "/src"
-		vprintln(work_path)
-		os.Chdir(work_path)
-	}
-	additional_clang_flags := c2v.get_additional_flags(path)
-	cmd := fmt.Sprintf("clang %s -w -Xclang -ast-dump=json "+
-		"-fsyntax-only -fno-diagnostics-color -c %s", additional_clang_flags, quoted_path(path))
-	vprintln("DA CMD")
-	vprintln(cmd)
-	out_ast := ""
-
-	// file.c => file.json
-	out_ast = replace(path, ext, ".json")
-
-	//out_ast_dir := os.dir(out_ast)
-
-	vprintf("EXT=%v out_ast=%v\n", ext, out_ast)
-	vprintf("out_ast=%v\n", out_ast)
-	clang_cmd := exec.Command(fmt.Sprintf("%s > %s", cmd, out_ast))
-	clang_result := clang_cmd.Run()
-	if clang_result != nil {
-		eprintln("\nThe file ${path} could not be parsed as a C source file.")
-		// TODO exit or return?
-		return
-		//panic(1)
+	if is_ast_file(path) {
+		// offline mode, see offline.go
+		c_file = c2v.c_file_for_ast(path)
+	}
+	if c_file != "" {
+		// the `["file.c"] additional_flags` are needed by clang, set them before it runs
+		c2v.set_config_overrides_for_file(c_file)
+	}
+	if !is_ast_file(path) {
+		// file.c => file.json, next to file.c with -keep_ast
+		ast_path = strings.TrimSuffix(path, filepath.Ext(path)) + ".json"
+		if !c2v.keep_ast {
+			tmp_dir, err := os.MkdirTemp("", "c2v")
+			if err != nil {
+				eprintln(err.Error())
+				c2v.proj.add_errors(path, []error{err})
+				c2v.report.add_errors([]error{err})
+				return
+			}
+			defer os.RemoveAll(tmp_dir)
+			ast_path = filepath.Join(tmp_dir, filepath.Base(ast_path))
+		}
+		vprintf("out_ast=%v\n", ast_path)
+		if err := c2v.dump_ast(path, ast_path); err != nil {
+			eprintln(err.Error())
+			c2v.proj.add_errors(path, []error{err})
+			c2v.report.add_errors([]error{err})
+			return
+		}
+		// without the macros the file is still translated, with their values inlined
+		if err := c2v.dump_macros(path, macros_path_of(ast_path)); err != nil {
+			c2v.report.Warnings = append(c2v.report.Warnings, err.Error())
+			infof("%s\n", err)
+		}
 	}
-	lines, _ = ReadLines(out_ast)
-	ast_path = out_ast
-	vprintf("lines.len=%d\n", len(lines))
-	out_v := replace(out_ast, ".json", ".v")
+	out_v := c2v.out_path(path)
 	rootdir, _ := os.Getwd()
 	short_output_path := replace(out_v, rootdir+"/", "")
-	c_file := path
-	c2v.add_file(ast_path, out_v, c_file)
+	err := c2v.translate_ast(ast_path, c_file, out_v)
+	errs := []error{}
+	for _, e := range c2v.errors {
+		errs = append(errs, e)
+	}
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, e := range errs {
+		eprintln(e.Error())
+	}
+	c2v.proj.add_errors(path, errs)
+	c2v.report.add_errors(errs)
+	if err != nil {
+		return
+	}
+	c2v.proj.translated()
+	if c2v.check_only {
+		infof("  checking %-15s ... %d errors\n", path, len(errs))
+		return
+	}
+	c2v.report.Output = out_v
+	delta_ticks := time.Now().Sub(start_ticks)
+	// a single write, so that the lines of concurrent translations don't get mixed up
+	infof("  translating %-15s ... took %d ms ; output file: %s\n", path,
+		delta_ticks.Milliseconds(), short_output_path)
+}
+
+// translate_ast translates the Clang JSON AST of c_file into out_v. The constructs that
+// can't be translated are skipped and collected in c2v.errors.
+func (c2v *C2V) translate_ast(ast_path, c_file, out_v string) (err error) {
+	defer c2v.recover_translation(&err)
+	if err := c2v.add_file(ast_path, out_v, c_file); err != nil {
+		return err
+	}
+	if c2v.turn != nil {
+		<-c2v.turn
+	}
+	if c2v.print_tree {
+		c2v.print_entire_tree()
+	}
 
 	// preparation pass, fill in the Node redeclarations field:
 	seen_ids := map[string]*Node{}
@@ -2103,27 +1437,78 @@ func (c2v *C2V) translate_file(path string) {
 			}
 		}
 	}
+	c2v.macro_decls()
 	// Main parse loop
 	for i, node := range c2v.tree.inner {
-		vprintf(`\ndoing top node %d %v name="%s" is_std=%v\n`, i,
+		vprintf("\ndoing top node %d %v name=\"%s\" is_std=%v\n", i,
 			node.kind, node.name, node.is_builtin_type)
 		c2v.node_i = i
 		c2v.top_level(node)
 	}
-	/*
-		if os.args.contains("-print_tree") {
-			c2v.print_entire_tree()
-		}
-		if !os.args.contains("-keep_ast") {
-			os.rm(out_ast)
-		}
-	*/
 	vprintln("DONE!2")
-	c2v.save()
-	c2v.translations++
-	delta_ticks := time.Now().Sub(start_ticks)
-	fmt.Printf("took %d ms ; output .v file: %s\n", delta_ticks.Microseconds(), short_output_path)
-	//println(" took ${delta_ticks:5} ms ; output .v file: ${short_output_path}")
+	return c2v.save()
+}
+
+// fork returns a fresh C2V for translating one more file of the project. It shares
+// the configuration and the project state (types, enums, globals) with c2v.
+func (c2v *C2V) fork() *C2V {
+	c := *c2v
+	c.tree = nil
+	c.out = code_buffer{}
+	c.fns = nil
+	c.labels = map[string]string{}
+	c.errors = nil
+	c.report = &FileReport{}
+	c.macros = nil
+	c.macro_consts = nil
+	c.comment_pos = 0
+	c.emitter = new_emitter(&c, c.target)
+	return &c
+}
+
+type translation_job struct {
+	path string
+	turn <-chan struct{} // closed when the previous file of the output folder is translated
+	done chan struct{}
+}
+
+// translate_files translates the files of a directory with c2v.jobs workers. Their ASTs
+// are dumped and decoded concurrently, but the files of an output folder share their
+// declarations, so they are translated one by one in the order of paths: the first file
+// using a type, an enum or a const generates it, whatever -j is. The folders don't wait
+// for each other.
+func (c2v *C2V) translate_files(paths []string) {
+	jobs := make(chan translation_job)
+	var wg sync.WaitGroup
+	for i := 0; i < c2v.jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				c := c2v.fork()
+				c.turn = job.turn
+				c.translate_file(job.path)
+				// a file that failed before its turn still waits for it, to keep the order
+				<-job.turn
+				close(job.done)
+			}
+		}()
+	}
+	first := make(chan struct{})
+	close(first)
+	turns := map[string]<-chan struct{}{}
+	for _, path := range paths {
+		dir := filepath.Dir(c2v.out_path(path))
+		turn, ok := turns[dir]
+		if !ok {
+			turn = first
+		}
+		done := make(chan struct{})
+		jobs <- translation_job{path, turn, done}
+		turns[dir] = done
+	}
+	close(jobs)
+	wg.Wait()
 }
 
 func (c2v *C2V) print_entire_tree() {
@@ -2133,8 +1518,7 @@ func (c2v *C2V) print_entire_tree() {
 }
 
 func print_node_recursive(node *Node, ident int) {
-	vprint(repeat("  ", ident))
-	vprintf(`"%v n="%s"`, node.kind, node.name)
+	fmt.Printf("%s%s n=%q\n", repeat("  ", ident), node.kind_str, node.name)
 	for _, child := range node.inner {
 		print_node_recursive(child, ident+1)
 	}
@@ -2147,9 +1531,11 @@ func print_node_recursive(node *Node, ident int) {
 
 func (c *C2V) top_level(node *Node) {
 	if node.is_builtin_type {
-		vprintf(`is std, ret (name="%s")\n`, node.name)
+		vprintf("is std, ret (name=\"%s\")\n", node.name)
+		c.report.SkippedBuiltins++
 		return
 	}
+	c.gen_comments(node)
 	if node.kindof(typedef_decl) {
 		c.typedef_decl(node)
 	} else if node.kindof(function_decl) {
@@ -2161,15 +1547,11 @@ func (c *C2V) top_level(node *Node) {
 	} else if node.kindof(enum_decl) {
 		c.enum_decl(node)
 	} else if !c.cpp_top_level(node) {
-		vprintf("\n\nUnhandled non C++ top level node typ=%v:\n", node.ast_type)
-		panic(1)
+		c.add_unhandled(node, "unhandled top level declaration")
+		c.stub(node)
 	}
 }
 
-func (node *Node) get_int_define() string {
-	return "HEADER"
-}
-
 // ""struct Foo":"struct Foo""  => "Foo"
 func parse_c_struct_name(typ string) string {
 	res := all_before(typ, ":")
@@ -2196,33 +1578,33 @@ func capitalize_type(s string) string {
 		// TODO this can result in conflicts
 		name = trim_underscores(name)
 	}
-	if !starts_with(name, "func ") {
+	if !starts_with(name, "fn ") {
 		name = capitalize(name)
 	}
 	return name
 }
 
-func (c *C2V) verror(msg string) {
-	panic(1)
-}
-
 func (c *C2V) contains_word(word string) bool {
+	if c.cur_file == "" && c.c_file_contents == "" {
+		// an offline AST without its .c file, there's no way to tell which declarations
+		// come from headers, so everything is translated
+		return true
+	}
 	return contains(c.c_file_contents, word)
 }
 
-func (c2v *C2V) save_globals() {
-	globals_path := c2v.get_globals_path()
-	lines := []string{}
-
-	lines = append(lines, "[translated]\n")
-	if c2v.has_cfile {
-		lines = append(lines, "[typedef]\nstruct C.FILE {}")
+func (c2v *C2V) save_globals() error {
+	if c2v.check_only {
+		return nil
 	}
-	for _, g := range c2v.globals_out {
-		lines = append(lines, g)
+	for _, dir := range c2v.proj.globals_dirs() {
+		lines := c2v.emitter.globals_header()
+		lines = append(lines, c2v.proj.sorted_globals_out(dir)...)
+		if err := write_file_atomic(c2v.globals_path_in(dir), strings.Join(lines, "\n")+"\n"); err != nil {
+			return err
+		}
 	}
-
-	WriteLines(lines, globals_path)
+	return nil
 }
 
 func types_are_equal(a string, b string) bool {
@@ -2236,11 +1618,6 @@ func types_are_equal(a string, b string) bool {
 }
 
 func (c *C2V) global_contains(s string) bool {
-	for _, v := range c.globals {
-		if v.name == s {
-			return true
-		}
-	}
-
-	return false
+	_, ok := c.proj.global(c.out_dir(), s)
+	return ok
 }
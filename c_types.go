@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DataModel is the size assumption for C's `long`, it's the only primitive whose
+// width differs between 64 bit platforms.
+type DataModel int
+
+const (
+	lp64  DataModel = iota // Linux, macOS: `long` is 64 bits
+	llp64                  // Windows: `long` is 32 bits
+)
+
+// set with `-data_model=llp64`
+var data_model = lp64
+
+type PrimKind int
+
+const (
+	prim_int PrimKind = iota
+	prim_uint
+	prim_char // plain `char`, the element of C strings
+	prim_float
+	prim_bool
+	prim_size  // size_t, uintptr_t: as wide as a pointer
+	prim_ssize // ptrdiff_t, intptr_t, ssize_t
+	prim_void
+)
+
+// Prim is a C primitive type with its size resolved
+type Prim struct {
+	kind PrimKind
+	bits int
+}
+
+// Fixed size typedefs from <stdint.h>, <stddef.h> and friends
+var c_typedef_prims = map[string]Prim{
+	"int8_t":    {prim_int, 8},
+	"int16_t":   {prim_int, 16},
+	"int32_t":   {prim_int, 32},
+	"int64_t":   {prim_int, 64},
+	"uint8_t":   {prim_uint, 8},
+	"uint16_t":  {prim_uint, 16},
+	"uint32_t":  {prim_uint, 32},
+	"uint64_t":  {prim_uint, 64},
+	"intmax_t":  {prim_int, 64},
+	"uintmax_t": {prim_uint, 64},
+	"size_t":    {prim_size, 64},
+	"uintptr_t": {prim_size, 64},
+	"ssize_t":   {prim_ssize, 64},
+	"ptrdiff_t": {prim_ssize, 64},
+	"intptr_t":  {prim_ssize, 64},
+	"_Bool":     {prim_bool, 8},
+	"bool":      {prim_bool, 8},
+	"void":      {prim_void, 0},
+}
+
+// normalize_c_primitive brings the spellings of a C integer type to one form:
+// `unsigned` => `unsigned int`, `long int` => `long`, `signed short` => `short`
+func normalize_c_primitive(typ string) string {
+	words := strings.Fields(typ)
+	unsigned := false
+	signed := false
+	rest := []string{}
+	for _, w := range words {
+		switch w {
+		case "unsigned":
+			unsigned = true
+		case "signed":
+			signed = true
+		default:
+			rest = append(rest, w)
+		}
+	}
+	base := strings.Join(rest, " ")
+	if base != "int" {
+		// `long int`, `short int`, `long long int`
+		base = strings.TrimSuffix(base, " int")
+	}
+	if base == "" {
+		base = "int"
+	}
+	if unsigned {
+		return "unsigned " + base
+	}
+	if signed && base == "char" {
+		// plain `char` and `signed char` are different types
+		return "signed char"
+	}
+	return base
+}
+
+// type_overrides are the typedefs of the project that are primitives, from the `[types]`
+// table of c2v.toml: `boolean = "bool"` for DOOM's `typedef enum {false, true} boolean;`
+var type_overrides = map[string]Prim{}
+
+// c_primitive resolves a C primitive type (without pointers and qualifiers)
+func c_primitive(typ string) (Prim, bool) {
+	typ = trim_space(typ)
+	if p, ok := type_overrides[typ]; ok {
+		return p, true
+	}
+	if p, ok := c_typedef_prims[typ]; ok {
+		return p, true
+	}
+	// __uint32_t, __int64_t
+	if p, ok := c_typedef_prims[strings.TrimLeft(typ, "_")]; ok && starts_with(typ, "__") {
+		return p, true
+	}
+	long_bits := 64
+	if data_model == llp64 {
+		long_bits = 32
+	}
+	switch normalize_c_primitive(typ) {
+	case "char":
+		return Prim{prim_char, 8}, true
+	case "signed char":
+		return Prim{prim_int, 8}, true
+	case "unsigned char":
+		return Prim{prim_uint, 8}, true
+	case "short":
+		return Prim{prim_int, 16}, true
+	case "unsigned short":
+		return Prim{prim_uint, 16}, true
+	case "int":
+		return Prim{prim_int, 32}, true
+	case "unsigned int":
+		return Prim{prim_uint, 32}, true
+	case "long":
+		return Prim{prim_int, long_bits}, true
+	case "unsigned long":
+		return Prim{prim_uint, long_bits}, true
+	case "long long":
+		return Prim{prim_int, 64}, true
+	case "unsigned long long":
+		return Prim{prim_uint, 64}, true
+	case "float":
+		return Prim{prim_float, 32}, true
+	case "double", "long double":
+		// there's no 80/128 bit float in V and Go
+		return Prim{prim_float, 64}, true
+	}
+	return Prim{}, false
+}
+
+func v_primitive(p Prim) string {
+	switch p.kind {
+	case prim_int:
+		if p.bits == 32 {
+			return "int"
+		}
+		return fmt.Sprintf("i%d", p.bits)
+	case prim_uint, prim_char:
+		return fmt.Sprintf("u%d", p.bits)
+	case prim_float:
+		return fmt.Sprintf("f%d", p.bits)
+	case prim_bool:
+		return "bool"
+	case prim_size:
+		return "usize"
+	case prim_ssize:
+		return "isize"
+	}
+	return "void"
+}
+
+func go_primitive(p Prim) string {
+	switch p.kind {
+	case prim_int:
+		return fmt.Sprintf("int%d", p.bits)
+	case prim_uint:
+		return fmt.Sprintf("uint%d", p.bits)
+	case prim_char:
+		return "byte"
+	case prim_float:
+		return fmt.Sprintf("float%d", p.bits)
+	case prim_bool:
+		return "bool"
+	case prim_size:
+		return "uintptr"
+	case prim_ssize:
+		return "int"
+	}
+	return ""
+}
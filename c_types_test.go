@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestConvertPrimitiveTypes(t *testing.T) {
+	tests := map[string]string{
+		"int":                  "int",
+		"unsigned":             "u32",
+		"long":                 "i64",
+		"unsigned long int":    "u64",
+		"long long":            "i64",
+		"signed char":          "i8",
+		"unsigned char *":      "&u8",
+		"short int":            "i16",
+		"uint16_t":             "u16",
+		"__int32_t":            "int",
+		"size_t":               "usize",
+		"ptrdiff_t":            "isize",
+		"_Bool":                "bool",
+		"long double":          "f64",
+		"const float":          "f32",
+		"struct user_t *":      "&User_t",
+		"int [3]":              "[3]int",
+		"int (*)(int, char *)": "fn (int, &u8) int",
+	}
+	for c_type, want := range tests {
+		if got := convert_type(c_type).name; got != want {
+			t.Errorf("convert_type(%q) = %q, want: %q", c_type, got, want)
+		}
+	}
+	if got := go_type("unsigned long"); got != "uint64" {
+		t.Errorf("Result: %q, want: uint64", got)
+	}
+	data_model = llp64
+	defer func() { data_model = lp64 }()
+	if got := convert_type("long").name; got != "int" {
+		t.Errorf("llp64 long: %q, want: int", got)
+	}
+	if got := go_type("unsigned long"); got != "uint32" {
+		t.Errorf("llp64 unsigned long: %q, want: uint32", got)
+	}
+}
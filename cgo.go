@@ -0,0 +1,380 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// `c2v wrapper -target=go foo.h` generates a cgo package for a C header: aliases of the
+// C types, and Go funcs calling the C functions that convert strings, slices and
+// out-params.
+
+// go_export_name turns `point_len` into `PointLen`, ALL_CAPS names are kept
+func go_export_name(name string) string {
+	if strings.ToUpper(name) == name {
+		return name
+	}
+	sb := strings.Builder{}
+	for _, part := range strings.Split(name, "_") {
+		if part == "" {
+			continue
+		}
+		sb.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	if sb.Len() == 0 || !unicode.IsLetter(rune(sb.String()[0])) {
+		return "X" + sb.String()
+	}
+	return sb.String()
+}
+
+// cgo_prims are the cgo names of the C primitives: `unsigned long` is `C.ulong`
+var cgo_prims = map[string]string{
+	"char":               "C.char",
+	"signed char":        "C.schar",
+	"unsigned char":      "C.uchar",
+	"short":              "C.short",
+	"unsigned short":     "C.ushort",
+	"int":                "C.int",
+	"unsigned int":       "C.uint",
+	"long":               "C.long",
+	"unsigned long":      "C.ulong",
+	"long long":          "C.longlong",
+	"unsigned long long": "C.ulonglong",
+	"float":              "C.float",
+	"double":             "C.double",
+	"long double":        "C.double",
+	"_Bool":              "C.bool",
+}
+
+// cgo_type_name is the type cgo gives a C type: `struct Point *` => `*C.struct_Point`
+func cgo_type_name(t *CType) string {
+	switch t.kind {
+	case ctype_pointer:
+		if t.elem.is_void() {
+			return "unsafe.Pointer"
+		}
+		if t.elem.kind == ctype_func {
+			// cgo has no func types, C function pointers are opaque
+			return "*[0]byte"
+		}
+		return "*" + cgo_type_name(t.elem)
+	case ctype_array:
+		return "[" + t.size + "]" + cgo_type_name(t.elem)
+	case ctype_record:
+		if t.is_union {
+			return "C.union_" + t.name
+		}
+		return "C.struct_" + t.name
+	case ctype_enum:
+		return "C.enum_" + t.name
+	case ctype_typedef:
+		return "C." + t.name
+	}
+	if name, ok := cgo_prims[normalize_c_primitive(t.name)]; ok {
+		return name
+	}
+	return "C." + t.name
+}
+
+// cgo_key is how a record, enum or typedef is registered in go_emitter.cgo_types
+func cgo_key(t *CType) string {
+	switch t.kind {
+	case ctype_record:
+		if t.is_union {
+			return "union " + t.name
+		}
+		return "struct " + t.name
+	case ctype_enum:
+		return "enum " + t.name
+	}
+	return t.name
+}
+
+// cgo_go_type is the type of a value in the Go API: a primitive, a type of the header
+// (`Point`), or the cgo type for the others
+func (e *go_emitter) cgo_go_type(t *CType) string {
+	switch t.kind {
+	case ctype_pointer:
+		if t.elem.is_void() || t.elem.kind == ctype_func {
+			return cgo_type_name(t)
+		}
+		return "*" + e.cgo_go_type(t.elem)
+	case ctype_record, ctype_enum, ctype_typedef:
+		if name, ok := e.cgo_types[cgo_key(t)]; ok {
+			return name
+		}
+		if prim, ok := c_primitive(t.name); ok && t.kind == ctype_typedef {
+			return go_primitive(prim)
+		}
+		return cgo_type_name(t)
+	case ctype_prim:
+		prim, _ := c_primitive(t.name)
+		return go_primitive(prim)
+	}
+	return cgo_type_name(t)
+}
+
+// cgo_same_type reports whether the Go type of a pointer is its cgo type: the types of
+// the header are aliases of the C types, but the numbers and the enums are Go numbers
+func (e *go_emitter) cgo_same_type(t *CType) bool {
+	for t.kind == ctype_pointer || t.kind == ctype_array {
+		if t.elem.is_void() || t.elem.kind == ctype_func {
+			return true
+		}
+		t = t.elem
+	}
+	switch t.kind {
+	case ctype_record:
+		return true
+	case ctype_typedef:
+		if name, ok := e.cgo_types[t.name]; ok {
+			return !e.cgo_enums[name]
+		}
+		_, is_prim := c_primitive(t.name)
+		return !is_prim
+	}
+	return false
+}
+
+func (e *go_emitter) add_cgo_type(key string, c_name string) string {
+	if e.cgo_types == nil {
+		e.cgo_types = map[string]string{}
+	}
+	name := go_export_name(c_name)
+	e.cgo_types[key] = name
+	return name
+}
+
+func (e *go_emitter) cgo_header(body string) string {
+	s := fmt.Sprintf("package %s\n\n/*\n", e.c.wrapper_module_name)
+	if contains(body, "C.free(") {
+		s += "#include <stdlib.h>\n"
+	}
+	s += fmt.Sprintf("#include \"%s\"\n*/\nimport \"C\"\n\n", filepath.Base(e.c.cur_file))
+	if contains(body, "unsafe.") {
+		s += "import \"unsafe\"\n\n"
+	}
+	return s
+}
+
+func (e *go_emitter) cgo_struct_decl(s *StructDecl) {
+	if s.name == "struct" || s.name == "union" {
+		// anonymous, only used in a field
+		return
+	}
+	t := &CType{kind: ctype_record, name: s.name, is_union: s.is_union}
+	if s.is_typedef {
+		t.kind = ctype_typedef
+	}
+	name := e.add_cgo_type(cgo_key(t), s.name)
+	e.c.genln(fmt.Sprintf("type %s = %s\n", name, cgo_type_name(t)))
+}
+
+// The enum values are the C constants, so that they can't get out of sync with the header
+func (e *go_emitter) cgo_enum_decl(en *EnumDecl) {
+	c := e.c
+	if en.name != "" {
+		name := e.add_cgo_type("enum "+en.name, en.name)
+		// a typedef of an anonymous enum is named by the typedef
+		e.cgo_types[en.name] = name
+		if e.cgo_enums == nil {
+			e.cgo_enums = map[string]bool{}
+		}
+		e.cgo_enums[name] = true
+		c.genln(fmt.Sprintf("type %s = int32\n", name))
+	}
+	c.genln("const (")
+	for _, val := range en.vals {
+		c.gen_doc(val.doc)
+		c.genln(fmt.Sprintf("\t%s = C.%s%s", go_export_name(val.name), val.name, trailing(val.comment)))
+	}
+	c.genln(")\n")
+}
+
+func (e *go_emitter) cgo_typedef_decl(alias string) {
+	name := e.add_cgo_type(alias, alias)
+	e.c.genln(fmt.Sprintf("type %s = C.%s\n", name, alias))
+}
+
+// is_len_param reports whether a param is the length of the array before it: `int *xs, size_t n`
+func is_len_param(name string, t *CType) bool {
+	if t.kind == ctype_pointer || t.kind == ctype_array {
+		return false
+	}
+	prim, ok := c_primitive(t.name)
+	if !ok || (prim.kind != prim_int && prim.kind != prim_uint && prim.kind != prim_size) {
+		return false
+	}
+	name = to_lower(name)
+	for _, s := range []string{"len", "length", "count", "size", "num", "n"} {
+		if name == s || ends_with(name, "_"+s) || starts_with(name, s+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+// is_number_pointer reports whether a param is a non const pointer to a number: `int *w`
+func is_number_pointer(t *CType) bool {
+	if t.kind != ctype_pointer || t.elem.is_const || t.elem.kind != ctype_prim {
+		return false
+	}
+	prim, ok := c_primitive(t.elem.name)
+	return ok && prim.kind != prim_char && prim.kind != prim_void
+}
+
+// returns_owned_string reports whether the caller has to free the `char *` a function
+// returns: it's not const and the function is named like an allocation, `strdup`,
+// `user_name_dup`, `str_new`
+func returns_owned_string(name string, ret *CType) bool {
+	if ret.elem.is_const {
+		return false
+	}
+	for _, word := range strings.Split(to_lower(name), "_") {
+		if word == "dup" || word == "strdup" || word == "alloc" || word == "new" || word == "copy" {
+			return true
+		}
+	}
+	return false
+}
+
+// is_out_name reports whether a param is named as an out-param: `out`, `out_len`, `len_out`
+func is_out_name(name string) bool {
+	name = to_lower(name)
+	return name == "out" || starts_with(name, "out_") || ends_with(name, "_out")
+}
+
+// out_params_start returns the index of the params that are pointers to numbers the
+// function writes into: several number pointers at the end, `void get_size(int *w, int *h)`.
+// A single one can be an array or an in/out value (`void fill(unsigned char *buf)`,
+// `void inc(int *x)`), it's an out-param only if it's named like one.
+func out_params_start(params []Param) int {
+	start := len(params)
+	for start > 0 && is_number_pointer(parse_ctype_or_void(params[start-1].typ)) {
+		start--
+	}
+	if len(params)-start < 2 {
+		return len(params)
+	}
+	return start
+}
+
+func is_c_string(t *CType) bool {
+	return t.kind == ctype_pointer && t.elem.is_const && t.elem.kind == ctype_prim && t.elem.name == "char"
+}
+
+func (e *go_emitter) cgo_func_decl(fn *FuncDecl) {
+	c := e.c
+	name := go_export_name(fn.name)
+	if fn.is_variadic {
+		c.genln(fmt.Sprintf("// %s is not wrapped, cgo can't call variadic C functions\n", name))
+		return
+	}
+	ret, err := parse_ctype(fn.ret)
+	if err != nil {
+		c.add_error(fn.body, fmt.Sprintf("%s: %v", fn.name, err))
+		return
+	}
+	params := []string{}
+	prologue := []string{}
+	args := []string{}
+	results := []string{}
+	outs := []string{}
+	outs_start := out_params_start(fn.params)
+	for i := 0; i < len(fn.params); i++ {
+		param := fn.params[i]
+		t, err := parse_ctype(param.typ)
+		if err != nil {
+			c.add_error(fn.body, fmt.Sprintf("%s: %v", fn.name, err))
+			return
+		}
+		pname := param.name
+		if pname == "" {
+			pname = fmt.Sprintf("arg%d", i)
+		} else if is_go_keyword(pname) {
+			pname += "_"
+		}
+		switch {
+		case is_c_string(t):
+			params = append(params, pname+" string")
+			prologue = append(prologue, fmt.Sprintf("c_%s := C.CString(%s)", pname, pname),
+				fmt.Sprintf("defer C.free(unsafe.Pointer(c_%s))", pname))
+			args = append(args, "c_"+pname)
+		case t.kind == ctype_pointer && i+1 < len(fn.params) && !t.elem.is_void() &&
+			t.elem.kind != ctype_func && is_len_param(fn.params[i+1].name, parse_ctype_or_void(fn.params[i+1].typ)):
+			// a slice: the pointer to its data and its length
+			params = append(params, pname+" []"+e.cgo_go_type(t.elem))
+			args = append(args, fmt.Sprintf("(%s)(unsafe.Pointer(unsafe.SliceData(%s)))", cgo_type_name(t), pname),
+				fmt.Sprintf("%s(len(%s))", cgo_type_name(parse_ctype_or_void(fn.params[i+1].typ)), pname))
+			i++
+		case is_number_pointer(t) && (i >= outs_start || is_out_name(param.name)):
+			typ := e.cgo_go_type(t.elem)
+			prologue = append(prologue, fmt.Sprintf("var c_%s %s", pname, cgo_type_name(t.elem)))
+			args = append(args, "&c_"+pname)
+			results = append(results, typ)
+			outs = append(outs, fmt.Sprintf("%s(c_%s)", typ, pname))
+		case t.kind == ctype_pointer && !e.cgo_same_type(t):
+			params = append(params, pname+" "+e.cgo_go_type(t))
+			args = append(args, fmt.Sprintf("(%s)(unsafe.Pointer(%s))", cgo_type_name(t), pname))
+		case t.kind == ctype_pointer || t.kind == ctype_array:
+			params = append(params, pname+" "+e.cgo_go_type(t))
+			args = append(args, pname)
+		default:
+			params = append(params, pname+" "+e.cgo_go_type(t))
+			args = append(args, fmt.Sprintf("%s(%s)", cgo_type_name(t), pname))
+		}
+	}
+	call := fmt.Sprintf("C.%s(%s)", fn.c_name, join_strs(args, ", "))
+	ret_val := ""
+	switch {
+	case ret.is_void():
+	case ret.kind == ctype_pointer && ret.elem.kind == ctype_prim && ret.elem.name == "char" &&
+		returns_owned_string(fn.name, ret):
+		prologue = append(prologue, "c_r := "+call, "defer C.free(unsafe.Pointer(c_r))")
+		call = "c_r"
+		ret_val = "C.GoString(c_r)"
+		results = append([]string{"string"}, results...)
+	case ret.kind == ctype_pointer && ret.elem.kind == ctype_prim && ret.elem.name == "char":
+		c.genln(fmt.Sprintf("// %s copies the string, the C string is still owned by C", name))
+		ret_val = fmt.Sprintf("C.GoString(%s)", call)
+		results = append([]string{"string"}, results...)
+	case ret.kind == ctype_pointer:
+		ret_val = call
+		results = append([]string{e.cgo_go_type(ret)}, results...)
+	default:
+		typ := e.cgo_go_type(ret)
+		ret_val = fmt.Sprintf("%s(%s)", typ, call)
+		results = append([]string{typ}, results...)
+	}
+	result := join_strs(results, ", ")
+	if len(results) > 1 {
+		result = "(" + result + ")"
+	}
+	c.genln(trim_space(fmt.Sprintf("func %s(%s) %s", name, join_strs(params, ", "), result)) + " {")
+	for _, line := range prologue {
+		c.genln("\t" + line)
+	}
+	switch {
+	case len(outs) == 0 && ret_val == "":
+		c.genln("\t" + call)
+	case len(outs) == 0:
+		c.genln("\treturn " + ret_val)
+	case ret_val == "":
+		c.genln("\t" + call)
+		c.genln("\treturn " + join_strs(outs, ", "))
+	default:
+		c.genln("\tr := " + ret_val)
+		c.genln("\treturn " + join_strs(append([]string{"r"}, outs...), ", "))
+	}
+	c.genln("}\n")
+}
+
+func parse_ctype_or_void(s string) *CType {
+	t, err := parse_ctype(s)
+	if err != nil {
+		return &CType{kind: ctype_prim, name: "void"}
+	}
+	return t
+}
@@ -0,0 +1,77 @@
+package main
+
+import "testing"
+
+func TestGoExportName(t *testing.T) {
+	for name, want := range map[string]string{
+		"point_len": "PointLen",
+		"Point":     "Point",
+		"DIR_UP":    "DIR_UP",
+		"_x":        "X",
+		"2d_vec":    "X2dVec",
+	} {
+		if got := go_export_name(name); got != want {
+			t.Errorf("go_export_name(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestIsLenParam(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		typ  string
+		want bool
+	}{
+		{"n", "size_t", true},
+		{"buf_len", "int", true},
+		{"count", "unsigned int", true},
+		{"x", "int", false},
+		{"len", "int *", false},
+		{"size", "float", false},
+	} {
+		if got := is_len_param(tc.name, parse_ctype_or_void(tc.typ)); got != tc.want {
+			t.Errorf("is_len_param(%q, %q) = %v", tc.name, tc.typ, got)
+		}
+	}
+}
+
+func TestOutParamsStart(t *testing.T) {
+	for _, tc := range []struct {
+		params []Param
+		want   int
+	}{
+		{[]Param{{name: "p", typ: "const Point *"}, {name: "w", typ: "int *"}, {name: "h", typ: "int *"}}, 1},
+		// a single pointer can be a buffer or an in/out value
+		{[]Param{{name: "buf", typ: "unsigned char *"}}, 1},
+		{[]Param{{name: "x", typ: "int *"}}, 1},
+		{[]Param{{name: "w", typ: "int *"}, {name: "s", typ: "const char *"}}, 2},
+	} {
+		if got := out_params_start(tc.params); got != tc.want {
+			t.Errorf("out_params_start(%v) = %d, want %d", tc.params, got, tc.want)
+		}
+	}
+	if !is_out_name("out_n") || !is_out_name("len_out") || is_out_name("outline") {
+		t.Error("is_out_name")
+	}
+}
+
+func TestReturnsOwnedString(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		ret  string
+		want bool
+	}{
+		{"strdup", "char *", true},
+		{"user_name_dup", "char *", true},
+		{"str_new", "char *", true},
+		{"user_name", "char *", false},
+		// a const string can't be freed by the caller
+		{"name_dup", "const char *", false},
+		{"newline", "char *", false},
+	} {
+		ret, _ := parse_ctype(tc.ret)
+		if got := returns_owned_string(tc.name, ret); got != tc.want {
+			t.Errorf("returns_owned_string(%s, %s) = %v, want %v", tc.name, tc.ret, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Debian and Ubuntu only install versioned binaries unless clang is installed as a
+// default, so the plain name is tried first, then the newest versions.
+var clang_names = []string{"clang", "clang-20", "clang-19", "clang-18", "clang-17", "clang-16",
+	"clang-15", "clang-14", "clang-13"}
+
+// find_clang_in_path returns $C2V_CLANG or the first clang found in PATH, "" if there's none
+func find_clang_in_path() string {
+	if clang := os.Getenv("C2V_CLANG"); clang != "" {
+		return clang
+	}
+	for _, name := range clang_names {
+		if path, err := exec.LookPath(name); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// ClangDiagnostic is an `a.c:3:5: error: use of undeclared identifier 'x'` line of clang's stderr
+type ClangDiagnostic struct {
+	file     string
+	line     int
+	col      int
+	severity string // "error", "warning", "fatal error"
+	msg      string
+}
+
+func (d ClangDiagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s", d.file, d.line, d.col, d.severity, d.msg)
+}
+
+// ClangError is returned when clang fails to dump the AST of a file
+type ClangError struct {
+	file        string
+	argv        []string
+	stderr      string
+	diagnostics []ClangDiagnostic
+	err         error
+}
+
+func (e *ClangError) Error() string {
+	msg := fmt.Sprintf("%s could not be parsed as a C source file (%v)", e.file, e.err)
+	if len(e.diagnostics) > 0 {
+		for _, d := range e.diagnostics {
+			msg += "\n  " + d.String()
+		}
+	} else if stderr := trim_space(e.stderr); stderr != "" {
+		// no diagnostics, clang itself failed (`unknown argument`, missing binary, ...)
+		msg += "\n  " + strings.ReplaceAll(stderr, "\n", "\n  ")
+	}
+	return msg
+}
+
+func (e *ClangError) Unwrap() error {
+	return e.err
+}
+
+// parse_clang_diagnostics collects the errors of clang's stderr, notes and source
+// snippets (`   10 | int x = y;`) are skipped.
+func parse_clang_diagnostics(stderr string) []ClangDiagnostic {
+	diags := []ClangDiagnostic{}
+	for _, line := range strings.Split(stderr, "\n") {
+		// `C:\a.c:1:2: error: ...` has an extra colon, so the fields are searched from the severity
+		for _, severity := range []string{"fatal error", "error"} {
+			i := strings.Index(line, ": "+severity+": ")
+			if i == -1 {
+				continue
+			}
+			loc := strings.Split(line[:i], ":")
+			if len(loc) < 3 {
+				break
+			}
+			n := len(loc)
+			line_nr, err1 := strconv.Atoi(loc[n-2])
+			col, err2 := strconv.Atoi(loc[n-1])
+			if err1 != nil || err2 != nil {
+				break
+			}
+			diags = append(diags, ClangDiagnostic{
+				file:     strings.Join(loc[:n-2], ":"),
+				line:     line_nr,
+				col:      col,
+				severity: severity,
+				msg:      line[i+len(severity)+4:],
+			})
+			break
+		}
+	}
+	return diags
+}
+
+// clang_argv returns the command that dumps the AST of path, and the folder to run it in
+// (the folder of the compile_commands.json entry, so that its relative paths work).
+func (c2v *C2V) clang_argv(path string) ([]string, string) {
+	return c2v.clang_command(path, "-Xclang", "-ast-dump=json", "-fsyntax-only")
+}
+
+// macros_argv returns the command that prints the macros defined after preprocessing path
+func (c2v *C2V) macros_argv(path string) ([]string, string) {
+	return c2v.clang_command(path, "-dM", "-E")
+}
+
+func (c2v *C2V) clang_command(path string, action ...string) ([]string, string) {
+	clang := c2v.clang_path
+	if clang == "" {
+		clang = find_clang_in_path()
+	}
+	argv := []string{clang}
+	argv = append(argv, split_command_line(c2v.get_additional_flags(path))...)
+	dir := ""
+	if flags, cmd_dir, ok := c2v.clang_flags_for_file(path); ok {
+		argv = append(argv, flags...)
+		dir = cmd_dir
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	argv = append(argv, "-w")
+	argv = append(argv, action...)
+	argv = append(argv, "-fno-diagnostics-color", "-c", path)
+	return argv, dir
+}
+
+// dump_ast runs clang on path and streams its JSON AST into out_ast
+func (c2v *C2V) dump_ast(path string, out_ast string) error {
+	argv, dir := c2v.clang_argv(path)
+	return run_clang(path, argv, dir, out_ast)
+}
+
+// dump_macros writes the `#define`s clang sees in path (`clang -dM -E`) into out_macros
+func (c2v *C2V) dump_macros(path string, out_macros string) error {
+	argv, dir := c2v.macros_argv(path)
+	return run_clang(path, argv, dir, out_macros)
+}
+
+// run_clang runs argv in dir, streaming its stdout into out
+func run_clang(path string, argv []string, dir string, out string) error {
+	if argv[0] == "" {
+		return &ClangError{file: path, argv: argv,
+			err: fmt.Errorf("clang was not found in PATH, install it or use `-clang=/path/to/clang`")}
+	}
+	debugf("%s\n", strings.Join(argv, " "))
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	stderr := bytes.Buffer{}
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Dir = dir
+	cmd.Stdout = f
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return &ClangError{file: path, argv: argv, stderr: stderr.String(),
+			diagnostics: parse_clang_diagnostics(stderr.String()), err: err}
+	}
+	return nil
+}
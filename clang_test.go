@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseClangDiagnostics(t *testing.T) {
+	stderr := `a.c:3:10: fatal error: 'foo.h' file not found
+    3 | #include "foo.h"
+      |          ^~~~~~~
+C:\src\b.c:7:5: error: use of undeclared identifier 'x'
+b.c:1:1: note: previous definition is here
+1 error generated.
+`
+	diags := parse_clang_diagnostics(stderr)
+	if len(diags) != 2 {
+		t.Fatalf("Result: %v, want 2 diagnostics", diags)
+	}
+	if d := diags[0]; d.file != "a.c" || d.line != 3 || d.col != 10 || d.severity != "fatal error" ||
+		d.msg != "'foo.h' file not found" {
+		t.Errorf("Result: %#v", d)
+	}
+	if d := diags[1]; d.file != `C:\src\b.c` || d.line != 7 || d.severity != "error" {
+		t.Errorf("Result: %#v", d)
+	}
+}
+
+func TestDumpAstReportsStderr(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as clang")
+	}
+	dir := t.TempDir()
+	clang := filepath.Join(dir, "fake-clang")
+	script := "#!/bin/sh\necho '{}'\necho \"x.c:2:1: error: expected ';'\" >&2\nexit 1\n"
+	os.WriteFile(clang, []byte(script), 0755)
+	c2v := test_c2v("-clang=" + clang)
+	err := c2v.dump_ast(filepath.Join(dir, "x.c"), filepath.Join(dir, "x.json"))
+	var clang_err *ClangError
+	if !errors.As(err, &clang_err) {
+		t.Fatalf("Result: %v, want a *ClangError", err)
+	}
+	if len(clang_err.diagnostics) != 1 || clang_err.diagnostics[0].msg != "expected ';'" {
+		t.Errorf("Result: %#v", clang_err.diagnostics)
+	}
+	if !strings.Contains(err.Error(), "x.c:2:1: error: expected ';'") {
+		t.Errorf("Result: %v", err)
+	}
+	// stdout goes to the AST file
+	if out, _ := os.ReadFile(filepath.Join(dir, "x.json")); string(out) != "{}\n" {
+		t.Errorf("Result: %q", out)
+	}
+}
+
+func TestTranslateKeepsFilesNextToSource(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as clang")
+	}
+	dir := t.TempDir()
+	ast, _ := filepath.Abs(filepath.Join("testdata", "decls.json"))
+	clang := filepath.Join(dir, "fake-clang")
+	script := "#!/bin/sh\ncase \"$*\" in *-dM*) echo '#define N 1' ;; *) cat '" + ast + "' ;; esac\n"
+	os.WriteFile(clang, []byte(script), 0755)
+	src, _ := os.ReadFile(filepath.Join("testdata", "decls.c"))
+	os.WriteFile(filepath.Join(dir, "x.c"), src, 0644)
+	// the output of a previous `c2v dump-ast`
+	os.WriteFile(filepath.Join(dir, "x.json"), []byte("{}"), 0644)
+	c2v := test_c2v("-q", "-clang="+clang)
+	defer func() { log_level = log_info }()
+	c2v.translate_file(filepath.Join(dir, "x.c"))
+	if n := c2v.proj.error_count(); n != 0 {
+		t.Fatalf("%d errors", n)
+	}
+	if out, _ := os.ReadFile(filepath.Join(dir, "x.json")); string(out) != "{}" {
+		t.Errorf("x.json was overwritten: %.40q", out)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "x.macros")); err == nil {
+		t.Error("x.macros was written next to x.c")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "x.v")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClangGetsFileFlags(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as clang")
+	}
+	dir := t.TempDir()
+	ast, _ := filepath.Abs(filepath.Join("testdata", "decls.json"))
+	clang := filepath.Join(dir, "fake-clang")
+	argv_log := filepath.Join(dir, "argv")
+	script := "#!/bin/sh\necho \"$*\" >> '" + argv_log + "'\ncase \"$*\" in *-dM*) ;; *) cat '" + ast + "' ;; esac\n"
+	os.WriteFile(clang, []byte(script), 0755)
+	src, _ := os.ReadFile(filepath.Join("testdata", "decls.c"))
+	os.WriteFile(filepath.Join(dir, "info.c"), src, 0644)
+	os.WriteFile(filepath.Join(dir, "c2v.toml"), []byte("[\"info.c\"]\nadditional_flags = \"-DINFO=1\"\n"), 0644)
+	t.Setenv("C2V_CONFIG", "")
+	for _, dump_only := range []bool{false, true} {
+		os.Remove(argv_log)
+		c2v := test_c2v("-q", "-clang="+clang)
+		defer func() { log_level = log_info }()
+		c2v.set_project_folder(dir)
+		if err := c2v.handle_configuration(); err != nil {
+			t.Fatal(err)
+		}
+		if dump_only {
+			c2v.dump_asts(filepath.Join(dir, "info.c"))
+		} else {
+			c2v.translate_file(filepath.Join(dir, "info.c"))
+		}
+		argv, _ := os.ReadFile(argv_log)
+		// the AST and the macros
+		if n := strings.Count(string(argv), "-DINFO=1"); n != 2 {
+			t.Errorf("dump-ast %v: clang ran with:\n%s", dump_only, argv)
+		}
+	}
+}
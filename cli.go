@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+const version = "0.1.0"
+
+// version_string adds the git revision when c2v was built from a checkout
+func version_string() string {
+	s := "c2v " + version
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return s
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" && len(setting.Value) >= 7 {
+			s += " (" + setting.Value[:7] + ")"
+		}
+	}
+	return s
+}
+
+type CliCommand struct {
+	name string
+	args string
+	help string
+}
+
+var cli_commands = []CliCommand{
+	{"translate", "file.c|file.json|folder/", "translate C to V or Go (the default command)"},
+	{"wrapper", "file.h", "generate V or Go (cgo) bindings for the functions and types of a header"},
+	{"dump-ast", "file.c|folder/", "only dump the Clang JSON ASTs and macros, to translate them later with -offline"},
+	{"check", "file.c|folder/", "translate without writing anything, report the errors"},
+	{"version", "", "print the version"},
+	{"help", "", "print this help"},
+}
+
+type CliFlag struct {
+	name  string // `-target=` has its value after `=`
+	value string // `-j N` has a separate value
+	help  string
+}
+
+var cli_flags = []CliFlag{
+	{"-target=", "", "v (default) or go"},
+	{"-o", "dir", "the output folder, instead of next to the file or folder/c2v_out.dir"},
+	{"-j", "N", "run clang on N files at a time, the files of an output folder are still translated one by one"},
+	{"-include=", "", "only translate the files matching these comma separated globs: src/**/*.c"},
+	{"-exclude=", "", "skip the files and folders matching these globs: *_test.c,vendor"},
+	{"-clang=", "", "the clang binary, $C2V_CLANG or clang from PATH by default"},
+	{"-cflags=", "", `more clang flags: -cflags="-Iinclude -DNDEBUG"`},
+	{"-compile_commands=", "", "the compile_commands.json with the flags of each file"},
+	{"-offline", "", "translate the .json ASTs of a folder instead of running clang"},
+	{"-c_file=", "", "the C file a .json AST was dumped from"},
+	{"-keep_ast", "", "keep the .json ASTs and .macros dumped by clang, next to the C files"},
+	{"-print_tree", "", "print the AST of each file"},
+	{"-stubs", "", "keep the C code of what can't be translated in TODO comments"},
+	{"-module=", "", "the module of `c2v wrapper`, the name of the header by default"},
+	{"-report", "file.json", "write what was translated and what wasn't, per file"},
+	{"-data_model=", "", "llp64 for a 32 bit `long`, like on Windows"},
+	{"-q", "", "only print errors"},
+	{"-v", "", "print the clang commands (-vv: trace every node)"},
+	{"-vv", "", ""},
+}
+
+// find_cli_flag returns the flag arg is, and whether its value is the next arg
+func find_cli_flag(arg string) (CliFlag, bool, bool) {
+	for _, flag := range cli_flags {
+		switch {
+		case ends_with(flag.name, "=") && starts_with(arg, flag.name):
+			return flag, false, true
+		case arg == flag.name:
+			return flag, flag.value != "", true
+		case flag.value != "" && starts_with(arg, flag.name+"="):
+			return flag, false, true
+		}
+	}
+	return CliFlag{}, false, false
+}
+
+// CliArg is a flag of the command line with its value: `-j 4`, `-target=go`, `-stubs`
+type CliArg struct {
+	name  string // the name of the CliFlag
+	value string
+}
+
+// parse_command_line splits `c2v [command] [flags] path` (os.Args[1:]). The flags are
+// validated here, and applied by new_c2v().
+func parse_command_line(args []string) (string, []CliArg, string, error) {
+	if len(args) == 0 {
+		return "help", nil, "", nil
+	}
+	cmd := "translate"
+	for _, c := range cli_commands {
+		if args[0] == c.name {
+			cmd = c.name
+			args = args[1:]
+			break
+		}
+	}
+	flags := []CliArg{}
+	path := ""
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "-h" || arg == "-help" || arg == "--help" {
+			return "help", nil, "", nil
+		}
+		if !starts_with(arg, "-") {
+			if path != "" {
+				return cmd, nil, "", fmt.Errorf("expected one file or folder, got %q and %q", path, arg)
+			}
+			path = arg
+			continue
+		}
+		flag, has_value, ok := find_cli_flag(arg)
+		if !ok {
+			return cmd, nil, "", fmt.Errorf("unknown flag %s", arg)
+		}
+		value := ""
+		if has_value {
+			if i+1 == len(args) {
+				return cmd, nil, "", fmt.Errorf("%s needs a value", arg)
+			}
+			i++
+			value = args[i]
+		} else if ends_with(flag.name, "=") {
+			value = arg[len(flag.name):]
+		} else if flag.value != "" {
+			value = arg[len(flag.name)+1:]
+		}
+		if err := check_flag_value(flag.name, value); err != nil {
+			return cmd, nil, "", err
+		}
+		flags = append(flags, CliArg{flag.name, value})
+	}
+	if path == "" && cmd != "help" && cmd != "version" {
+		return cmd, nil, "", fmt.Errorf("no file or folder to %s", cmd)
+	}
+	return cmd, flags, path, nil
+}
+
+func check_flag_value(name string, value string) error {
+	switch name {
+	case "-target=":
+		if value != "v" && value != "go" {
+			return fmt.Errorf("unknown target %q, expected v or go", value)
+		}
+	case "-data_model=":
+		if value != "lp64" && value != "llp64" {
+			return fmt.Errorf("unknown data model %q, expected lp64 or llp64", value)
+		}
+	case "-j":
+		if n, err := strconv.Atoi(value); err != nil || n < 1 {
+			return fmt.Errorf("-j needs a number of files, got %q", value)
+		}
+	}
+	return nil
+}
+
+func usage() string {
+	lines := []string{
+		"C to V/Go translator " + version,
+		"",
+		"Usage: c2v [command] [flags] file.c|folder/",
+		"",
+		"Commands:",
+	}
+	for _, c := range cli_commands {
+		lines = append(lines, fmt.Sprintf("  %-34s %s", trim_space(c.name+" "+c.args), c.help))
+	}
+	lines = append(lines, "", "Flags:")
+	for _, flag := range cli_flags {
+		if flag.help == "" {
+			continue
+		}
+		name := flag.name
+		if ends_with(name, "=") {
+			name += "..."
+		} else if flag.value != "" {
+			name += " " + flag.value
+		}
+		lines = append(lines, fmt.Sprintf("  %-34s %s", name, flag.help))
+	}
+	lines = append(lines, "", "Examples:",
+		"  c2v file.c",
+		"  c2v -target=go -j 8 -exclude=*_test.c folder/",
+		"  c2v dump-ast folder/ && c2v -offline folder/",
+	)
+	return strings.Join(lines, "\n")
+}
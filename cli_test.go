@@ -0,0 +1,36 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCommandLine(t *testing.T) {
+	cmd, flags, path, err := parse_command_line([]string{"-target=go", "-j", "4", "-report=r.json", "-v", "folder"})
+	want := []CliArg{{"-target=", "go"}, {"-j", "4"}, {"-report", "r.json"}, {"-v", ""}}
+	if err != nil || cmd != "translate" || path != "folder" || !reflect.DeepEqual(flags, want) {
+		t.Errorf("Result: %v %v %v %v", cmd, flags, path, err)
+	}
+	cmd, _, path, err = parse_command_line([]string{"dump-ast", "-o", "out", "a.c"})
+	if err != nil || cmd != "dump-ast" || path != "a.c" {
+		t.Errorf("Result: %v %v %v", cmd, path, err)
+	}
+	for _, args := range [][]string{{"-nope", "a.c"}, {"a.c", "b.c"}, {"check"}, {"a.c", "-j"},
+		{"-target=rust", "a.c"}, {"-data_model=ilp32", "a.c"}, {"-j", "0", "a.c"}} {
+		if _, _, _, err := parse_command_line(args); err == nil {
+			t.Errorf("%q must be an error", args)
+		}
+	}
+	if cmd, _, _, _ := parse_command_line([]string{"a.c", "--help"}); cmd != "help" {
+		t.Errorf("Result: %v, want: help", cmd)
+	}
+}
+
+// test_c2v is new_c2v() with the flags of a command line
+func test_c2v(flags ...string) *C2V {
+	_, args, _, err := parse_command_line(append(flags, "x.c"))
+	if err != nil {
+		panic(err)
+	}
+	return new_c2v(args)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+)
+
+// code_buffer accumulates generated code line by line.
+//
+// Named checkpoints remember a position in the buffer, so that everything generated
+// after it can be cut and moved somewhere else (globals go to _globals.v).
+type code_buffer struct {
+	buf         []byte
+	indent      int
+	checkpoints map[string]int
+}
+
+func (b *code_buffer) at_line_start() bool {
+	return len(b.buf) == 0 || b.buf[len(b.buf)-1] == '\n'
+}
+
+func (b *code_buffer) gen(s string) {
+	if s == "" {
+		return
+	}
+	if b.indent > 0 && b.at_line_start() {
+		b.buf = append(b.buf, strings.Repeat("\t", b.indent)...)
+	}
+	b.buf = append(b.buf, s...)
+}
+
+func (b *code_buffer) genln(s string) {
+	b.gen(s)
+	b.buf = append(b.buf, '\n')
+}
+
+// join_lines removes the trailing newline, so that the next gen() continues
+// the last line (`}` + ` else {`)
+func (b *code_buffer) join_lines() {
+	if len(b.buf) > 0 && b.buf[len(b.buf)-1] == '\n' {
+		b.buf = b.buf[:len(b.buf)-1]
+	}
+}
+
+// current_line returns the line that is being generated right now (without indentation)
+func (b *code_buffer) current_line() string {
+	start := b.current_line_start()
+	return strings.TrimLeft(string(b.buf[start:]), "\t")
+}
+
+func (b *code_buffer) current_line_start() int {
+	for i := len(b.buf) - 1; i >= 0; i-- {
+		if b.buf[i] == '\n' {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// set_current_line replaces the line that is being generated, e.g. to patch a func name
+// after its call expression has been generated
+func (b *code_buffer) set_current_line(s string) {
+	start := b.current_line_start()
+	b.buf = b.buf[:start]
+	b.gen(s)
+	b.drop_checkpoints_after(len(b.buf))
+}
+
+func (b *code_buffer) checkpoint(name string) {
+	if b.checkpoints == nil {
+		b.checkpoints = map[string]int{}
+	}
+	b.checkpoints[name] = len(b.buf)
+}
+
+// cut_since removes everything generated after the checkpoint `name` and returns it
+func (b *code_buffer) cut_since(name string) string {
+	pos, ok := b.checkpoints[name]
+	if !ok || pos > len(b.buf) {
+		return ""
+	}
+	s := string(b.buf[pos:])
+	b.buf = b.buf[:pos]
+	delete(b.checkpoints, name)
+	b.drop_checkpoints_after(pos)
+	return s
+}
+
+func (b *code_buffer) drop_checkpoints_after(pos int) {
+	for name, p := range b.checkpoints {
+		if p > pos {
+			delete(b.checkpoints, name)
+		}
+	}
+}
+
+func (b *code_buffer) str() string {
+	return string(b.buf)
+}
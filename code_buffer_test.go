@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCodeBufferIndent(t *testing.T) {
+	b := code_buffer{}
+	b.genln("func main() {")
+	b.indent++
+	b.gen("x := ")
+	b.genln("1")
+	b.indent--
+	b.genln("}")
+	expected := "func main() {\n\tx := 1\n}\n"
+
+	if b.str() != expected {
+		t.Errorf("Result: %q, want: %q", b.str(), expected)
+	}
+}
+
+func TestCodeBufferCutSince(t *testing.T) {
+	b := code_buffer{}
+	b.genln("module main")
+	b.checkpoint("global")
+	b.genln("__global ( x int )")
+	res := b.cut_since("global")
+
+	if res != "__global ( x int )\n" || b.str() != "module main\n" {
+		t.Errorf("Result: %q and %q", res, b.str())
+	}
+}
+
+func TestCodeBufferKeepsNames(t *testing.T) {
+	b := code_buffer{}
+	b.genln("is_true_value := false_positives")
+	expected := "is_true_value := false_positives\n"
+
+	if b.str() != expected {
+		t.Errorf("Result: %q, want: %q", b.str(), expected)
+	}
+}
+
+func TestCodeBufferSetCurrentLine(t *testing.T) {
+	b := code_buffer{}
+	b.genln("{")
+	b.indent = 1
+	b.gen("__builtin___memcpy_chk(")
+	b.set_current_line(replace_str(b.current_line(), "__builtin___memcpy_chk", "C.memcpy"))
+	expected := "{\n\tC.memcpy("
+
+	if b.str() != expected {
+		t.Errorf("Result: %q, want: %q", b.str(), expected)
+	}
+}
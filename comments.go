@@ -0,0 +1,223 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Clang only puts the doc comments in the AST (FullComment nodes), so all comments are
+// recovered from c_file_contents instead: the ones between the last translated node and
+// the next one are generated before it. c.comment_pos is how far the file has been
+// searched for comments.
+
+type SourceComment struct {
+	start int
+	end   int
+	text  string // verbatim, with `//` or `/* */`
+}
+
+// scan_comments returns the comments of src[from:to], skipping string literals and
+// preprocessor lines (their comments belong to the macros)
+func scan_comments(src string, from, to int) []SourceComment {
+	comments := []SourceComment{}
+	if from < 0 {
+		from = 0
+	}
+	if to > len(src) {
+		to = len(src)
+	}
+	for i := from; i < to; i++ {
+		switch {
+		case src[i] == '"' || src[i] == '\'':
+			quote := src[i]
+			for i++; i < to && src[i] != quote && src[i] != '\n'; i++ {
+				if src[i] == '\\' {
+					i++
+				}
+			}
+		case src[i] == '#' && strings.TrimSpace(src[line_start(src, i):i]) == "":
+			// skip to the end of the directive, with its `\` continuations
+			for i < to && !(src[i] == '\n' && src[i-1] != '\\') {
+				i++
+			}
+		case starts_with(src[i:], "//"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end == -1 {
+				end = len(src) - i
+			}
+			comments = append(comments, SourceComment{i, i + end, strings.TrimRight(src[i:i+end], " \t\r")})
+			i += end
+		case starts_with(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end == -1 {
+				return comments
+			}
+			end += i + 4
+			comments = append(comments, SourceComment{i, end, src[i:end]})
+			i = end - 1
+		}
+	}
+	return comments
+}
+
+func line_start(src string, i int) int {
+	return strings.LastIndexByte(src[:i], '\n') + 1
+}
+
+// comment_lines splits a block comment, removing the indentation it had in the C file
+func comment_lines(src string, com SourceComment) []string {
+	indent := src[line_start(src, com.start):com.start]
+	if strings.TrimSpace(indent) != "" {
+		// the comment follows code on its line
+		indent = ""
+	}
+	lines := strings.Split(com.text, "\n")
+	for i := 1; i < len(lines); i++ {
+		lines[i] = strings.TrimRight(strings.TrimPrefix(lines[i], indent), " \t\r")
+	}
+	return lines
+}
+
+var blank_line_re = regexp.MustCompile(`\n[ \t\r]*\n`)
+
+// comment_block returns the lines of the comments of c_file_contents[from:to], with the
+// blank lines that separate them from what follows
+func (c *C2V) comment_block(from, to int) []string {
+	src := c.c_file_contents
+	lines := []string{}
+	for _, com := range scan_comments(src, from, to) {
+		lines = append(lines, comment_lines(src, com)...)
+		next := strings.Index(src[com.end:to], "//")
+		if i := strings.Index(src[com.end:to], "/*"); i != -1 && (next == -1 || i < next) {
+			next = i
+		}
+		if next == -1 {
+			next = to - com.end
+		}
+		if blank_line_re.MatchString(src[com.end : com.end+next]) {
+			lines = append(lines, "")
+		}
+	}
+	return lines
+}
+
+// comments_before returns the comments between c.comment_pos and the node, and the
+// comment after it on its line if it's on a single line: `x++; // next`
+func (c *C2V) comments_before(node *Node) []string {
+	begin, end := node.range0.begin, node.range0.end
+	if !same_file(begin.file, c.cur_file) || begin.offset < c.comment_pos ||
+		begin.offset > len(c.c_file_contents) {
+		return nil
+	}
+	lines := c.comment_block(c.comment_pos, begin.offset)
+	c.comment_pos = begin.offset
+	if end.line == begin.line && end.offset >= begin.offset {
+		if trailing := c.comment_after(end.offset + end.tok_len); trailing != "" {
+			lines = append(lines, trailing)
+		}
+	}
+	return lines
+}
+
+// comment_after returns the `//` or single line `/* */` comment that ends the line of
+// offset, and moves c.comment_pos after it
+func (c *C2V) comment_after(offset int) string {
+	src := c.c_file_contents
+	if offset < c.comment_pos || offset > len(src) {
+		return ""
+	}
+	eol := strings.IndexByte(src[offset:], '\n')
+	if eol == -1 {
+		eol = len(src) - offset
+	}
+	coms := scan_comments(src, offset, offset+eol)
+	if len(coms) == 0 || contains(coms[0].text, "\n") {
+		return ""
+	}
+	c.comment_pos = coms[len(coms)-1].end
+	return coms[0].text
+}
+
+// gen_comments generates the comments before a declaration or a statement
+func (c *C2V) gen_comments(node *Node) {
+	if !c.out.at_line_start() {
+		// in the middle of a line (`if x` + statement), the comments go before the next line
+		return
+	}
+	for _, line := range c.comments_before(node) {
+		c.genln(line)
+	}
+}
+
+// gen_comments_before_line generates the comments before a line of the C file, for the
+// declarations without a node: the macros
+func (c *C2V) gen_comments_before_line(line int) {
+	offset := 0
+	for i := 1; i < line && offset < len(c.c_file_contents); i++ {
+		eol := strings.IndexByte(c.c_file_contents[offset:], '\n')
+		if eol == -1 {
+			return
+		}
+		offset += eol + 1
+	}
+	if offset < c.comment_pos {
+		return
+	}
+	for _, l := range c.comment_block(c.comment_pos, offset) {
+		c.genln(l)
+	}
+	c.comment_pos = offset
+}
+
+// gen_comments_until generates the comments before the `}` of a block
+func (c *C2V) gen_comments_until(block *Node) {
+	end := block.range0.end
+	if !same_file(end.file, c.cur_file) || end.offset < c.comment_pos || !c.out.at_line_start() {
+		return
+	}
+	for _, line := range c.comment_block(c.comment_pos, end.offset) {
+		c.genln(line)
+	}
+	c.comment_pos = end.offset
+}
+
+// member_comments returns the comments of a field or an enum value: the lines before
+// it, and the comment after it on its line
+func (c *C2V) member_comments(node *Node) ([]string, string) {
+	begin, end := node.range0.begin, node.range0.end
+	if !same_file(begin.file, c.cur_file) || begin.offset < c.comment_pos ||
+		begin.offset > len(c.c_file_contents) {
+		return nil, ""
+	}
+	doc := c.comment_block(c.comment_pos, begin.offset)
+	c.comment_pos = begin.offset
+	// the comment can follow the `,` or `;` after the member
+	return doc, c.comment_after(end.offset + end.tok_len)
+}
+
+// skip_comments_of moves c.comment_pos after a node whose inner comments are dropped
+func (c *C2V) skip_comments_of(node *Node) {
+	end := node.range0.end
+	if same_file(end.file, c.cur_file) && end.offset > c.comment_pos {
+		c.comment_pos = end.offset
+	}
+}
+
+// gen_doc generates the comment lines before a field or an enum value
+func (c *C2V) gen_doc(doc []string) {
+	for _, line := range doc {
+		if line == "" {
+			c.genln("")
+		} else {
+			c.genln("\t" + line)
+		}
+	}
+}
+
+// trailing is the comment after a field or an enum value, on its line
+func trailing(comment string) string {
+	if comment == "" {
+		return ""
+	}
+	return " " + comment
+}
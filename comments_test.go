@@ -0,0 +1,27 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScanComments(t *testing.T) {
+	src := "#define A 1 // macro\nchar *s = \"// no\"; /* a\n   b */ int x; // x\n"
+	texts := []string{}
+	for _, com := range scan_comments(src, 0, len(src)) {
+		texts = append(texts, com.text)
+	}
+	want := []string{"/* a\n   b */", "// x"}
+	if !reflect.DeepEqual(texts, want) {
+		t.Errorf("Result: %q, want: %q", texts, want)
+	}
+}
+
+func TestCommentLines(t *testing.T) {
+	src := "\t/**\n\t * doc\n\t */\n"
+	lines := comment_lines(src, scan_comments(src, 0, len(src))[0])
+	want := []string{"/**", " * doc", " */"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("Result: %q, want: %q", lines, want)
+	}
+}
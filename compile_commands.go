@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CompileCommand is an entry of a compile_commands.json (CMake's
+// CMAKE_EXPORT_COMPILE_COMMANDS, Bear), one per translation unit.
+type CompileCommand struct {
+	Directory string   `json:"directory"`
+	File      string   `json:"file"`
+	Arguments []string `json:"arguments"`
+	Command   string   `json:"command"` // used when there are no `arguments`
+}
+
+// load_compile_commands reads `-compile_commands=path`, `[project] compile_commands`, or
+// compile_commands.json (or build/compile_commands.json) in the project folder.
+func (c2v *C2V) load_compile_commands() error {
+	path := c2v.compile_commands_path
+	if path == "" {
+		path = c2v.conf.string_value("project", "compile_commands", "")
+		if path != "" && !filepath.IsAbs(path) {
+			path = filepath.Join(c2v.project_folder, path)
+		}
+	}
+	if path == "" {
+		for _, p := range []string{"compile_commands.json", "build/compile_commands.json"} {
+			p = filepath.Join(c2v.project_folder, p)
+			if _, err := os.Stat(p); err == nil {
+				path = p
+				break
+			}
+		}
+	}
+	if path == "" {
+		return nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read %s: %v", path, err)
+	}
+	cmds := []CompileCommand{}
+	if err := json.Unmarshal(content, &cmds); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	c2v.compile_commands = map[string]CompileCommand{}
+	for _, cmd := range cmds {
+		file := cmd.File
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(cmd.Directory, file)
+		}
+		c2v.compile_commands[filepath.Clean(file)] = cmd
+	}
+	return nil
+}
+
+// clang_flags_for_file returns the flags that affect parsing (`-I`, `-D`, `-U`, `-std`,
+// `-include`, ...) of the translation unit and the folder its compiler ran in.
+// Relative include paths are made absolute, so that clang can run from any folder.
+func (c2v *C2V) clang_flags_for_file(path string) ([]string, string, bool) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, "", false
+	}
+	cmd, ok := c2v.compile_commands[filepath.Clean(abs)]
+	if !ok {
+		return nil, "", false
+	}
+	args := cmd.Arguments
+	if len(args) == 0 {
+		args = split_command_line(cmd.Command)
+	}
+	return filter_clang_flags(args, cmd.Directory), cmd.Directory, true
+}
+
+// flags followed by a separate value: `-I dir`, `-D FOO`
+var clang_flags_with_value = map[string]bool{
+	"-I": true, "-D": true, "-U": true, "-include": true, "-isystem": true, "-iquote": true,
+	"-idirafter": true, "-imacros": true, "--sysroot": true,
+}
+
+// flags whose value is a path
+var clang_path_flags = []string{"-I", "-isystem", "-iquote", "-idirafter", "-include", "-imacros", "--sysroot="}
+
+// filter_clang_flags keeps the flags of a compiler command that affect parsing. The
+// others (`-O2`, `-Wall`, `-fno-tree-vrp`, `-mno-red-zone`) are dropped: they're often
+// gcc only, and clang fails on the ones it doesn't know.
+func filter_clang_flags(args []string, dir string) []string {
+	flags := []string{}
+	// the first arg is the compiler
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if clang_flags_with_value[arg] && i+1 < len(args) {
+			i++
+			flags = append(flags, arg, absolute_flag_path(arg, args[i], dir))
+			continue
+		}
+		switch {
+		case starts_with(arg, "-std="), arg == "-ansi", starts_with(arg, "-D"), starts_with(arg, "-U"):
+			flags = append(flags, arg)
+		default:
+			for _, flag := range clang_path_flags {
+				if starts_with(arg, flag) && len(arg) > len(flag) {
+					flags = append(flags, flag+absolute_flag_path(flag, arg[len(flag):], dir))
+					break
+				}
+			}
+		}
+	}
+	return flags
+}
+
+func absolute_flag_path(flag, val, dir string) string {
+	for _, f := range clang_path_flags {
+		if strings.TrimSuffix(f, "=") == strings.TrimSuffix(flag, "=") && !filepath.IsAbs(val) && dir != "" {
+			return filepath.Join(dir, val)
+		}
+	}
+	return val
+}
+
+// split_command_line splits a shell command like `cc -DNAME="a b" -c 'x.c'`
+func split_command_line(s string) []string {
+	args := []string{}
+	cur := strings.Builder{}
+	in_arg := false
+	quote := byte(0)
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			} else if ch == '\\' && quote == '"' && i+1 < len(s) {
+				i++
+				cur.WriteByte(s[i])
+			} else {
+				cur.WriteByte(ch)
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+			in_arg = true
+		case ch == '\\' && i+1 < len(s):
+			i++
+			cur.WriteByte(s[i])
+			in_arg = true
+		case ch == ' ' || ch == '\t' || ch == '\n':
+			if in_arg {
+				args = append(args, cur.String())
+				cur.Reset()
+				in_arg = false
+			}
+		default:
+			cur.WriteByte(ch)
+			in_arg = true
+		}
+	}
+	if in_arg {
+		args = append(args, cur.String())
+	}
+	return args
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitCommandLine(t *testing.T) {
+	args := split_command_line(`cc -DNAME="a b" -I'inc dir' -c x.c`)
+	want := []string{"cc", "-DNAME=a b", "-Iinc dir", "-c", "x.c"}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("Result: %q, want: %q", args, want)
+	}
+}
+
+func TestFilterClangFlags(t *testing.T) {
+	args := []string{"gcc", "-O2", "-Iinclude", "-I", "/usr/include/SDL2", "-DDEBUG=1", "-std=c99",
+		"-o", "x.o", "-c", "x.c", "-Wall", "-fno-strict-aliasing", "-fno-tree-vrp", "-fconserve-stack",
+		"-mno-red-zone", "-isystem", "sys", "--sysroot=/opt/sdk", "-include", "config.h", "-UNDEBUG"}
+	flags := filter_clang_flags(args, "/proj/build")
+	want := []string{"-I/proj/build/include", "-I", "/usr/include/SDL2", "-DDEBUG=1", "-std=c99",
+		"-isystem", "/proj/build/sys", "--sysroot=/opt/sdk", "-include", "/proj/build/config.h", "-UNDEBUG"}
+	if !reflect.DeepEqual(flags, want) {
+		t.Errorf("Result: %q, want: %q", flags, want)
+	}
+}
+
+func TestLoadCompileCommands(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "build"), 0755)
+	json := `[{"directory": "` + filepath.ToSlash(root) + `", "file": "src/a.c",
+		"command": "cc -Isrc -DFOO -c src/a.c"}]`
+	os.WriteFile(filepath.Join(root, "build", "compile_commands.json"), []byte(json), 0644)
+	c2v := test_c2v()
+	c2v.is_dir = true
+	c2v.set_project_folder(root)
+	if err := c2v.load_compile_commands(); err != nil {
+		t.Fatal(err)
+	}
+	flags, dir, ok := c2v.clang_flags_for_file(filepath.Join(root, "src", "a.c"))
+	if !ok || dir != filepath.ToSlash(root) {
+		t.Fatalf("no compile command for src/a.c (%v, %q)", ok, dir)
+	}
+	want := []string{"-I" + filepath.Join(root, "src"), "-DFOO"}
+	if !reflect.DeepEqual(flags, want) {
+		t.Errorf("Result: %q, want: %q", flags, want)
+	}
+	if _, _, ok := c2v.clang_flags_for_file(filepath.Join(root, "b.c")); ok {
+		t.Errorf("b.c is not in compile_commands.json")
+	}
+}
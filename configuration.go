@@ -1,16 +1,119 @@
 package main
 
-// called once per each .c file
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// path0 is the folder or the file passed on the CLI
+func (c2v *C2V) set_project_folder(path0 string) {
+	if abs, err := filepath.Abs(path0); err == nil {
+		path0 = abs
+	}
+	c2v.project_folder = path0
+	if fi, err := os.Stat(path0); err == nil && !fi.IsDir() {
+		c2v.project_folder = filepath.Dir(path0)
+	}
+	c2v.update_globals_path()
+}
+
+func (c2v *C2V) update_globals_path() {
+	c2v.project_globals_path = c2v.globals_path_in(c2v.output_root())
+}
+
+// globals_path_in is the _globals file of an output folder: the mirrored folders are
+// separate modules, every one has its own globals
+func (c2v *C2V) globals_path_in(dir string) string {
+	return filepath.Join(dir, "_globals"+c2v.emitter.ext())
+}
+
+// handle_configuration loads the file from the C2V_CONFIG env variable, or
+// project_folder/c2v.toml if it exists:
+//
+//	[project]
+//	output_dirname = "c2v_out.dir"
+//	additional_flags = "-I/some/folder"
+//	uses_sdl = true
+//	clang = "/usr/bin/clang-18"
+//
+//	["info.c"]
+//	additional_flags = "-I/xyz"
+//
+//	[types]
+//	boolean = "bool"
+func (c2v *C2V) handle_configuration() error {
+	path := os.Getenv("C2V_CONFIG")
+	if path == "" {
+		path = filepath.Join(c2v.project_folder, "c2v.toml")
+		if _, err := os.Stat(path); err != nil {
+			return nil
+		}
+	}
+	content, err := ReadTextFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read the configuration file %s: %v", path, err)
+	}
+	c2v.conf, err = parse_toml(content)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	c2v.project_output_dirname = c2v.conf.string_value("project", "output_dirname", c2v.project_output_dirname)
+	c2v.project_additional_flags = c2v.conf.string_value("project", "additional_flags", "")
+	if c2v.clang_path == "" {
+		c2v.clang_path = c2v.conf.string_value("project", "clang", "")
+	}
+	c2v.project_uses_sdl = c2v.conf.bool_value("project", "uses_sdl", false)
+	if c2v.project_uses_sdl {
+		sdl_cflags, err := get_sdl_cflags()
+		if err != nil {
+			return err
+		}
+		c2v.project_additional_flags += " " + sdl_cflags
+	}
+	type_overrides = map[string]Prim{}
+	for name, val := range c2v.conf.tables["types"] {
+		typ, _ := val.(string)
+		prim, ok := c_primitive(typ)
+		if !ok {
+			return fmt.Errorf("%s: [types] %s = %q is not a C primitive type", path, name, typ)
+		}
+		type_overrides[name] = prim
+	}
+	c2v.update_globals_path()
+	return nil
+}
+
+// called once per each .c file, the table can be the path relative to the project
+// folder (`["src/info.c"]`) or just the file name (`["info.c"]`)
 func (c2v *C2V) set_config_overrides_for_file(path0 string) {
-	// TODO impl
+	table := filepath.Base(path0)
+	if rel, err := filepath.Rel(c2v.project_folder, path0); err == nil {
+		if _, ok := c2v.conf.tables[filepath.ToSlash(rel)]; ok {
+			table = filepath.ToSlash(rel)
+		}
+	}
+	c2v.file_additional_flags = c2v.conf.string_value(table, "additional_flags", "")
 }
 
-func get_sdl_cflags() string {
-	return ""
+func get_sdl_cflags() (string, error) {
+	out, err := exec.Command("sdl2-config", "--cflags").Output()
+	if err != nil {
+		return "", fmt.Errorf("the project uses sdl, but `sdl2-config` failed: %v. Try installing libsdl2-dev", err)
+	}
+	return trim_space(string(out)), nil
 }
 
 func (c2v *C2V) get_additional_flags(path0 string) string {
-	return ""
+	flags := c2v.project_additional_flags
+	if c2v.file_additional_flags != "" {
+		flags += " " + c2v.file_additional_flags
+	}
+	if c2v.cli_clang_flags != "" {
+		flags += " " + c2v.cli_clang_flags
+	}
+	return trim_space(flags)
 }
 
 func (c2v *C2V) get_globals_path() string {
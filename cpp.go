@@ -5,7 +5,7 @@ import (
 )
 
 func (c *C2V) cpp_top_level(node *Node) bool {
-	println(`C++ top level`)
+	vprintln("C++ top level")
 	if node.kindof(namespace_decl) {
 		for _, child := range node.inner {
 			c.top_level(child)
@@ -119,7 +119,7 @@ func (c *C2V) cpp_expr(_node *Node) bool {
 		// std::string s = "HI";
 		vprintln(`expr with cle`)
 		typ := node.ast_type.qualified // get_val(-1)
-		vprintf(`TYP=%v\n`, typ)
+		vprintf("TYP=%v\n", typ)
 		if contains(typ, `basic_string<`) {
 			// All this for a simple std::string = "hello";
 			construct_expr := node.try_get_next_child_of_kind(cxx_construct_expr)
@@ -150,7 +150,7 @@ func (c *C2V) cpp_expr(_node *Node) bool {
 		typ_ := convert_type(node.ast_type.qualified) // get_val(2))
 		dtyp := typ_.name
 		dtyp = replace(dtyp, `* `, `&`)
-		c.gen(`${dtyp}( `)
+		c.gen(dtyp + "( ")
 		child := node.try_get_next_child()
 		c.expr(child)
 		c.gen(`)`)
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+type CTypeKind int
+
+const (
+	ctype_prim    CTypeKind = iota // int, unsigned long, size_t, void
+	ctype_pointer                  // also C++ references
+	ctype_array
+	ctype_func
+	ctype_record // struct or union
+	ctype_enum
+	ctype_typedef // any other name
+)
+
+// CType is a parsed Clang qualType: `int (*[2])(char *)` is an array of two pointers
+// to functions.
+type CType struct {
+	kind        CTypeKind
+	name        string // primitive, record, enum or typedef name
+	is_union    bool
+	is_const    bool
+	is_volatile bool
+	elem        *CType   // pointed to type, array element or function return type
+	size        string   // array length, empty for `[]`
+	params      []*CType // function params
+	is_variadic bool
+	is_ref      bool // C++ `&`
+}
+
+// `struct User *` => `*struct User`, `int (*)[4]` => `*[4]int`, `char *(*)(int)` => `*func(int) *char`
+func (t *CType) str() string {
+	s := ""
+	if t.is_const {
+		s += "const "
+	}
+	switch t.kind {
+	case ctype_pointer:
+		if t.is_ref {
+			return s + "&" + t.elem.str()
+		}
+		return s + "*" + t.elem.str()
+	case ctype_array:
+		return s + "[" + t.size + "]" + t.elem.str()
+	case ctype_func:
+		params := []string{}
+		for _, param := range t.params {
+			params = append(params, param.str())
+		}
+		if t.is_variadic {
+			params = append(params, "...")
+		}
+		return s + strings.TrimSpace(fmt.Sprintf("func(%s) %s", strings.Join(params, ", "), t.elem.str()))
+	case ctype_record:
+		if t.is_union {
+			return s + "union " + t.name
+		}
+		return s + "struct " + t.name
+	case ctype_enum:
+		return s + "enum " + t.name
+	}
+	return s + t.name
+}
+
+func (t *CType) is_void() bool {
+	return t.kind == ctype_prim && t.name == "void"
+}
+
+// has_const reports whether the type is const on any level (`const char *`)
+func (t *CType) has_const() bool {
+	for ; t != nil; t = t.elem {
+		if t.is_const {
+			return true
+		}
+	}
+	return false
+}
+
+// parse_ctype parses a Clang qualType with a recursive descent parser:
+//
+//	type       = specifiers declarator
+//	declarator = { "*" | "&" } [ "(" declarator ")" ] { "[" size "]" | "(" params ")" }
+func parse_ctype(s string) (*CType, error) {
+	p := &ctype_parser{src: s, toks: tokenize_ctype(s)}
+	t, err := p.typ()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, fmt.Errorf("unexpected %q in type %q", p.toks[p.pos], s)
+	}
+	return t, nil
+}
+
+type ctype_parser struct {
+	src  string
+	toks []string
+	pos  int
+}
+
+var ctype_prim_words = map[string]bool{
+	"void": true, "char": true, "short": true, "int": true, "long": true, "float": true,
+	"double": true, "signed": true, "unsigned": true, "_Bool": true, "bool": true,
+}
+
+func tokenize_ctype(s string) []string {
+	toks := []string{}
+	for i := 0; i < len(s); {
+		ch := s[i]
+		switch {
+		case ch == ' ' || ch == '\t':
+			i++
+		case strings.HasPrefix(s[i:], "(anonymous") || strings.HasPrefix(s[i:], "(unnamed"):
+			// `(unnamed struct at a.c:3:1)` is a single name
+			j := strings.IndexByte(s[i:], ')')
+			if j == -1 {
+				j = len(s) - i - 1
+			}
+			toks = append(toks, s[i:i+j+1])
+			i += j + 1
+		case strings.HasPrefix(s[i:], "..."):
+			toks = append(toks, "...")
+			i += 3
+		case is_ident_char(ch) || ch == ':':
+			j := i
+			for j < len(s) && (is_ident_char(s[j]) || s[j] == ':') {
+				j++
+			}
+			// C++ template args are a part of the name: `vector<int>`
+			if j < len(s) && s[j] == '<' {
+				depth := 0
+				for ; j < len(s); j++ {
+					if s[j] == '<' {
+						depth++
+					} else if s[j] == '>' {
+						depth--
+						if depth == 0 {
+							j++
+							break
+						}
+					}
+				}
+			}
+			toks = append(toks, s[i:j])
+			i = j
+		default:
+			toks = append(toks, string(ch))
+			i++
+		}
+	}
+	return toks
+}
+
+func is_ident_char(ch byte) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9')
+}
+
+func (p *ctype_parser) peek() string {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return ""
+}
+
+func (p *ctype_parser) next() string {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+func (p *ctype_parser) expect(tok string) error {
+	if got := p.next(); got != tok {
+		return fmt.Errorf("expected %q, got %q in type %q", tok, got, p.src)
+	}
+	return nil
+}
+
+func (p *ctype_parser) typ() (*CType, error) {
+	base, err := p.specifiers()
+	if err != nil {
+		return nil, err
+	}
+	return p.declarator(base)
+}
+
+// `const unsigned long`, `struct User`, `enum (unnamed at a.c:1:1)`, `size_t`
+func (p *ctype_parser) specifiers() (*CType, error) {
+	t := &CType{kind: ctype_prim}
+	prim := []string{}
+	for {
+		tok := p.peek()
+		switch {
+		case tok == "const":
+			t.is_const = true
+		case tok == "volatile":
+			t.is_volatile = true
+		case tok == "restrict" || tok == "__restrict" || tok == "static" || tok == "register" || tok == "inline":
+		case tok == "struct" || tok == "union" || tok == "enum" || tok == "class":
+			p.next()
+			t.kind = ctype_record
+			t.is_union = tok == "union"
+			if tok == "enum" {
+				t.kind = ctype_enum
+			}
+			name, err := p.tag_name()
+			if err != nil {
+				return nil, err
+			}
+			t.name = name
+			continue
+		case is_anon_type_name(tok) && len(prim) == 0 && t.name == "":
+			// `(anonymous struct at a.c:3:1)` without a tag keyword
+			t.kind = ctype_record
+			t.name = tok
+		case ctype_prim_words[tok]:
+			prim = append(prim, tok)
+		case tok != "" && is_ident_char(tok[0]) && len(prim) == 0 && t.name == "":
+			t.kind = ctype_typedef
+			t.name = tok
+		default:
+			if len(prim) > 0 {
+				t.name = normalize_c_primitive(strings.Join(prim, " "))
+			} else if t.name == "" {
+				return nil, fmt.Errorf("expected a type, got %q in type %q", tok, p.src)
+			}
+			return t, nil
+		}
+		p.next()
+	}
+}
+
+// `User`, or `(unnamed struct at a.c:3:1)` as a single name
+func (p *ctype_parser) tag_name() (string, error) {
+	name := p.next()
+	if name == "" || !is_ident_char(name[0]) && name[0] != ':' && !is_anon_type_name(name) {
+		return "", fmt.Errorf("expected a name, got %q in type %q", name, p.src)
+	}
+	return name, nil
+}
+
+func is_anon_type_name(s string) bool {
+	return strings.HasPrefix(s, "(anonymous") || strings.HasPrefix(s, "(unnamed")
+}
+
+func (p *ctype_parser) declarator(base *CType) (*CType, error) {
+	for p.peek() == "*" || p.peek() == "&" {
+		ptr := &CType{kind: ctype_pointer, elem: base, is_ref: p.next() == "&"}
+		for p.peek() == "const" || p.peek() == "volatile" || p.peek() == "restrict" || p.peek() == "__restrict" {
+			if p.next() == "const" {
+				ptr.is_const = true
+			}
+		}
+		base = ptr
+	}
+	// `(*)` is a nested declarator, `(int, char)` is a param list
+	if p.peek() == "(" && p.pos+1 < len(p.toks) &&
+		(p.toks[p.pos+1] == "*" || p.toks[p.pos+1] == "&" || p.toks[p.pos+1] == "(" || p.toks[p.pos+1] == "[") {
+		// Suffixes after the parens apply first: `int (*)[4]` is a pointer to `int [4]`.
+		// Skip the nested declarator, parse the suffixes, then come back.
+		inner_start := p.pos + 1
+		if err := p.skip_parens(); err != nil {
+			return nil, err
+		}
+		t, err := p.suffixes(base)
+		if err != nil {
+			return nil, err
+		}
+		end := p.pos
+		p.pos = inner_start
+		t, err = p.declarator(t)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		p.pos = end
+		return t, nil
+	}
+	return p.suffixes(base)
+}
+
+func (p *ctype_parser) skip_parens() error {
+	depth := 0
+	for p.pos < len(p.toks) {
+		tok := p.next()
+		if tok == "(" {
+			depth++
+		} else if tok == ")" {
+			depth--
+			if depth == 0 {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("unbalanced parens in type %q", p.src)
+}
+
+// `[2][3]` and `(int, char *)`; the rightmost suffix is the innermost type
+func (p *ctype_parser) suffixes(base *CType) (*CType, error) {
+	wrappers := []*CType{}
+	for p.peek() == "[" || p.peek() == "(" {
+		if p.next() == "[" {
+			t := &CType{kind: ctype_array}
+			for p.peek() != "]" && p.peek() != "" {
+				t.size += p.next()
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			wrappers = append(wrappers, t)
+			continue
+		}
+		t := &CType{kind: ctype_func}
+		for p.peek() != ")" {
+			if p.peek() == "..." {
+				p.next()
+				t.is_variadic = true
+			} else {
+				param, err := p.typ()
+				if err != nil {
+					return nil, err
+				}
+				t.params = append(t.params, param)
+			}
+			if p.peek() == "," {
+				p.next()
+			} else if p.peek() != ")" {
+				return nil, fmt.Errorf("expected \",\" or \")\", got %q in type %q", p.peek(), p.src)
+			}
+		}
+		p.next()
+		// `int (void)` has no params
+		if len(t.params) == 1 && t.params[0].is_void() {
+			t.params = nil
+		}
+		wrappers = append(wrappers, t)
+	}
+	for i := len(wrappers) - 1; i >= 0; i-- {
+		wrappers[i].elem = base
+		base = wrappers[i]
+	}
+	return base, nil
+}
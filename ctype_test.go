@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestParseCType(t *testing.T) {
+	tests := map[string]string{
+		"int":                          "int",
+		"unsigned long int":            "unsigned long",
+		"const char *":                 "*const char",
+		"char *const *":                "*const *char",
+		"struct User *":                "*struct User",
+		"union U":                      "union U",
+		"enum Color":                   "enum Color",
+		"size_t":                       "size_t",
+		"int [2][3]":                   "[2][3]int",
+		"int (*)[4]":                   "*[4]int",
+		"int *[4]":                     "[4]*int",
+		"int (int, char **)":           "func(int, **char) int",
+		"void (*)(void)":               "*func() void",
+		"char *(*)(int, ...)":          "*func(int, ...) *char",
+		"int (*[2])(int)":              "[2]*func(int) int",
+		"void (*(*)(int))(char)":       "*func(int) *func(char) void",
+		"void (*)(int (*)(double))":    "*func(*func(double) int) void",
+		"struct (unnamed at a.c:1:9)":  "struct (unnamed at a.c:1:9)",
+		"std::vector<int> &":           "&std::vector<int>",
+		"const volatile unsigned char": "const unsigned char",
+	}
+	for s, want := range tests {
+		typ, err := parse_ctype(s)
+		if err != nil {
+			t.Errorf("parse_ctype(%q): %v", s, err)
+			continue
+		}
+		if got := typ.str(); got != want {
+			t.Errorf("parse_ctype(%q) = %q, want: %q", s, got, want)
+		}
+	}
+	for _, s := range []string{"int (*", "int [3", "struct", "int )"} {
+		if _, err := parse_ctype(s); err == nil {
+			t.Errorf("parse_ctype(%q) should fail", s)
+		}
+	}
+}
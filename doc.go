@@ -7,7 +7,7 @@ import (
 func AppendComma(filename string) {
 	lines, err := ReadLines(filename)
 	if err != nil {
-		fmt.Printf("WARN: Cannot read file: %s!\n", filename)
+		eprintln(fmt.Sprintf("WARN: Cannot read file: %s!", filename))
 		return
 	}
 
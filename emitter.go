@@ -0,0 +1,76 @@
+package main
+
+// Emitter renders translated code for one output language.
+//
+// C2V walks the Clang AST, decides what has to be translated (skipping builtins,
+// declarations from other files, duplicates) and calls the emitter for every
+// construct whose syntax depends on the target. Emitters write with c.gen()/c.genln()
+// and call back into the walker (c.expr(), c.statements()) for nested nodes.
+type Emitter interface {
+	ext() string                       // extension of the translated files, e.g. ".v"
+	file_header(body string) string    // prepended to the file in save(), once all imports are known
+	globals_header() []string          // first lines of the _globals file
+	type_name(c_type string) string    // `unsigned int *` => `&u32`
+	func_decl(fn *FuncDecl)            // the signature and the body (with c.statements())
+	struct_decl(s *StructDecl)         // structs and unions
+	enum_decl(en *EnumDecl) bool       // also registers the values, false if another file generated the enum
+	typedef_decl(alias, c_type string) // `typedef unsigned int angle_t;`
+	macro_name(name string) string     // the name of a macro const or function: `BUFSIZE` => `bufsize`
+	macro_consts(ms []*Macro) int      // the object-like macros of a file (see macros.go), returns how many were generated
+	macro_fn(m *Macro) bool            // a function-like macro, as a generic function, false if another file generated it
+	global(g *GlobalDecl)              // a top level VarDecl
+	var_decl(node *Node, cinit bool)   // a single local VarDecl of a DeclStmt
+	gen_bool(node *Node)               // a condition, C uses ints as bools
+	stmt(node *Node) bool              // returns false if the shared walker should handle the statement
+	expr(node *Node) bool              // returns false if the shared walker should handle the expression
+}
+
+func new_emitter(c *C2V, target string) Emitter {
+	if target == "go" {
+		return &go_emitter{c: c}
+	}
+	return &v_emitter{c: c}
+}
+
+type FuncDecl struct {
+	name        string
+	c_name      string // name + C++ template args
+	ret         string // C return type
+	params      []Param
+	is_variadic bool
+	body        *Node // CompoundStmt, nil for declarations without a body
+}
+
+type Param struct {
+	name    string
+	typ     string   // C type
+	doc     []string // the comment lines before a field
+	comment string   // the comment after a field, on its line
+}
+
+type StructDecl struct {
+	name       string
+	is_union   bool
+	is_typedef bool // `typedef struct {...} name`, the C type is `name`, not `struct name`
+	fields     []Param
+}
+
+type EnumDecl struct {
+	name string // empty for anonymous enums (a list of consts)
+	vals []EnumVal
+}
+
+type EnumVal struct {
+	name    string
+	value   *Node // nil if the value is implicit
+	doc     []string
+	comment string
+}
+
+type GlobalDecl struct {
+	name      string
+	typ       string // C type
+	init      *Node  // nil if not initialized
+	is_extern bool
+	node      *Node
+}
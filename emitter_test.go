@@ -0,0 +1,156 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// recording_emitter records the declarations the walker decided to translate
+type recording_emitter struct {
+	c     *C2V
+	decls []string
+}
+
+func (e *recording_emitter) ext() string                       { return ".txt" }
+func (e *recording_emitter) file_header(body string) string    { return "" }
+func (e *recording_emitter) globals_header() []string          { return nil }
+func (e *recording_emitter) type_name(c_type string) string    { return c_type }
+func (e *recording_emitter) var_decl(node *Node, cinit bool)   {}
+func (e *recording_emitter) gen_bool(node *Node)               { e.c.expr(node) }
+func (e *recording_emitter) stmt(node *Node) bool              { return false }
+func (e *recording_emitter) expr(node *Node) bool              { return false }
+func (e *recording_emitter) typedef_decl(alias, c_type string) {}
+func (e *recording_emitter) macro_name(name string) string     { return name }
+func (e *recording_emitter) macro_consts(ms []*Macro) int      { return len(ms) }
+func (e *recording_emitter) macro_fn(m *Macro) bool            { return true }
+
+func (e *recording_emitter) func_decl(fn *FuncDecl) {
+	s := "fn " + fn.name + "(" + fn.ret
+	for _, p := range fn.params {
+		s += " " + p.name + ":" + p.typ
+	}
+	if fn.body != nil {
+		s += " body"
+	}
+	e.decls = append(e.decls, s+")")
+}
+
+func (e *recording_emitter) struct_decl(s *StructDecl) {
+	d := "struct " + s.name
+	for _, f := range s.fields {
+		d += " " + f.name + ":" + f.typ
+	}
+	e.decls = append(e.decls, d)
+}
+
+func (e *recording_emitter) enum_decl(en *EnumDecl) bool {
+	d := "enum " + en.name
+	for _, v := range en.vals {
+		d += " " + v.name
+		if v.value != nil {
+			d += "=" + v.value.value
+		}
+	}
+	e.decls = append(e.decls, d)
+	return true
+}
+
+func (e *recording_emitter) global(g *GlobalDecl) {
+	e.decls = append(e.decls, "global "+g.name+":"+g.typ)
+}
+
+const test_emitter_ast_json = `{
+  "id": "0x1", "kind": "TranslationUnitDecl", "loc": {}, "range": {"begin": {}, "end": {}},
+  "inner": [
+    {"id": "0x2", "kind": "RecordDecl", "loc": {"offset": 7, "file": "a.c", "line": 1}, "range": {"begin": {}, "end": {}},
+     "name": "Point", "tagUsed": "struct",
+     "inner": [
+       {"id": "0x3", "kind": "FieldDecl", "loc": {}, "range": {"begin": {}, "end": {}}, "name": "x", "type": {"qualType": "int"}},
+       {"id": "0x4", "kind": "FieldDecl", "loc": {}, "range": {"begin": {}, "end": {}}, "name": "y", "type": {"qualType": "int"}}
+     ]},
+    {"id": "0x5", "kind": "EnumDecl", "loc": {"offset": 30, "line": 2}, "range": {"begin": {}, "end": {}},
+     "name": "Color",
+     "inner": [
+       {"id": "0x6", "kind": "EnumConstantDecl", "loc": {}, "range": {"begin": {}, "end": {}}, "name": "RED", "type": {"qualType": "int"}},
+       {"id": "0x7", "kind": "EnumConstantDecl", "loc": {}, "range": {"begin": {}, "end": {}}, "name": "GREEN", "type": {"qualType": "int"},
+        "inner": [
+          {"id": "0x8", "kind": "ConstantExpr", "range": {"begin": {}, "end": {}}, "type": {"qualType": "int"},
+           "inner": [{"id": "0x9", "kind": "IntegerLiteral", "range": {"begin": {}, "end": {}}, "type": {"qualType": "int"}, "value": "5"}]}
+        ]}
+     ]},
+    {"id": "0xa", "kind": "VarDecl", "loc": {"offset": 60, "line": 3}, "range": {"begin": {}, "end": {}},
+     "name": "counter", "type": {"qualType": "int"}},
+    {"id": "0xb", "kind": "VarDecl", "loc": {"offset": 70, "line": 4}, "range": {"begin": {}, "end": {}},
+     "name": "unused", "type": {"qualType": "int"}},
+    {"id": "0xc", "kind": "FunctionDecl", "loc": {"offset": 80, "line": 5}, "range": {"begin": {}, "end": {}},
+     "name": "puts", "type": {"qualType": "int (const char *)"},
+     "inner": [
+       {"id": "0xd", "kind": "ParmVarDecl", "loc": {}, "range": {"begin": {}, "end": {}}, "name": "s", "type": {"qualType": "const char *"}}
+     ]},
+    {"id": "0xe", "kind": "FunctionDecl", "loc": {"offset": 100, "line": 6}, "range": {"begin": {}, "end": {}},
+     "name": "add", "type": {"qualType": "int (int, int)"},
+     "inner": [
+       {"id": "0xf", "kind": "ParmVarDecl", "loc": {}, "range": {"begin": {}, "end": {}}, "name": "a", "type": {"qualType": "int"}},
+       {"id": "0x10", "kind": "ParmVarDecl", "loc": {}, "range": {"begin": {}, "end": {}}, "name": "b", "type": {"qualType": "int"}},
+       {"id": "0x11", "kind": "CompoundStmt", "range": {"begin": {}, "end": {}}}
+     ]}
+  ]
+}`
+
+func TestWalkerCallsEmitter(t *testing.T) {
+	root, err := json_decode(test_emitter_ast_json)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := test_c2v()
+	e := &recording_emitter{c: c}
+	c.emitter = e
+	c.tree = root
+	// `unused` is only declared in a header, so it must be skipped
+	c.c_file_contents = "int counter; int puts(const char *s); int add(int a, int b) {}"
+	for i, node := range c.tree.inner {
+		c.node_i = i
+		c.top_level(node)
+	}
+	want := []string{
+		"struct Point x:int y:int",
+		"enum Color RED GREEN=5",
+		"global counter:int",
+		"fn puts(int s:const char *)",
+		"fn add(int a:int b:int body)",
+	}
+	if !reflect.DeepEqual(e.decls, want) {
+		t.Errorf("Result: %q, want: %q", e.decls, want)
+	}
+}
+
+func TestVarDeclResolvesTypedefs(t *testing.T) {
+	c := test_c2v()
+	c.emitter.var_decl(&Node{
+		kind:     var_decl,
+		name:     "a",
+		ast_type: AstJsonType{qualified: "angle_t", desugared_qualified: "unsigned int"},
+	}, false)
+	if got := c.out.str(); got != "a := Angle_t(0)" {
+		t.Errorf("Result: %q, want: %q", got, "a := Angle_t(0)")
+	}
+	c.out = code_buffer{}
+	c.emitter.var_decl(&Node{
+		kind:     var_decl,
+		name:     "b",
+		ast_type: AstJsonType{qualified: "angle_t", desugared_qualified: "unsigned int"},
+		inner:    []*Node{{kind: integer_literal, value: "5", ast_type: AstJsonType{qualified: "int"}}},
+	}, true)
+	if got := c.out.str(); got != "b := Angle_t(5)" {
+		t.Errorf("Result: %q, want: %q", got, "b := Angle_t(5)")
+	}
+	c.out = code_buffer{}
+	c.emitter.var_decl(&Node{
+		kind:     var_decl,
+		name:     "p",
+		ast_type: AstJsonType{qualified: "player_t", desugared_qualified: "struct player_s"},
+	}, false)
+	if got := c.out.str(); got != "p := Player_t{}" {
+		t.Errorf("Result: %q, want: %q", got, "p := Player_t{}")
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// TranslationError is a C construct that c2v can't translate. The errors are collected per
+// file, so that the rest of the file, and the other files of the project, are still translated.
+type TranslationError struct {
+	file      string
+	line      int
+	kind      string // the Clang node kind, e.g. "GCCAsmStmt"
+	msg       string
+	unhandled bool // c2v doesn't translate nodes of this kind, see add_unhandled()
+}
+
+func (e *TranslationError) Error() string {
+	loc := e.file
+	if e.line > 0 {
+		loc += fmt.Sprintf(":%d", e.line)
+	}
+	if e.kind != "" {
+		return fmt.Sprintf("%s: %s (%s)", loc, e.msg, e.kind)
+	}
+	return loc + ": " + e.msg
+}
+
+// add_error records an error at node, the caller skips the node
+func (c *C2V) add_error(node *Node, msg string) {
+	err := &TranslationError{file: c.cur_file, msg: msg}
+	if node != nil {
+		err.kind = node.kind_str
+		err.line = node.line()
+		if file := node.file(); file != "" {
+			// the node can come from a header
+			err.file = file
+		}
+	}
+	c.errors = append(c.errors, err)
+}
+
+// add_unhandled records a node of a kind c2v doesn't translate, they're counted by kind
+// in the report
+func (c *C2V) add_unhandled(node *Node, msg string) {
+	c.add_error(node, msg)
+	c.errors[len(c.errors)-1].unhandled = true
+}
+
+// recover_translation turns a crash of the translator into an error of the file
+// being translated, so that the other files of a directory are still translated.
+func (c *C2V) recover_translation(err *error) {
+	if r := recover(); r != nil {
+		vprintln(string(debug.Stack()))
+		*err = &TranslationError{file: c.cur_file, msg: fmt.Sprintf("c2v crashed: %v", r)}
+	}
+}
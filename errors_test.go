@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const test_errors_ast_json = `{
+  "id": "0x1", "kind": "TranslationUnitDecl", "loc": {}, "range": {"begin": {}, "end": {}},
+  "inner": [
+    {"id": "0x2", "kind": "StaticAssertDecl", "loc": {"offset": 0, "file": "e.c", "line": 1}, "range": {"begin": {"offset": 0}, "end": {"offset": 20}}},
+    {"id": "0x3", "kind": "FunctionDecl", "loc": {"offset": 30, "line": 2}, "range": {"begin": {"offset": 26}, "end": {"offset": 90, "line": 5}},
+     "name": "f", "type": {"qualType": "void (void)"},
+     "inner": [
+       {"id": "0x4", "kind": "CompoundStmt", "range": {"begin": {"offset": 35, "line": 2}, "end": {"offset": 90, "line": 5}},
+        "inner": [
+          {"id": "0x5", "kind": "DeclStmt", "range": {"begin": {"offset": 38, "line": 3}, "end": {"offset": 50}},
+           "inner": [{"id": "0x6", "kind": "VarDecl", "loc": {"offset": 49}, "range": {"begin": {"offset": 38}, "end": {"offset": 49}},
+                      "name": "x", "type": {"qualType": "int"}, "storageClass": "extern"}]},
+          {"id": "0x7", "kind": "StmtExpr", "range": {"begin": {"offset": 60, "line": 4}, "end": {"offset": 70}}, "type": {"qualType": "int"}}
+        ]}
+     ]}
+  ]
+}`
+
+func TestTranslationErrorsAreCollected(t *testing.T) {
+	dir := t.TempDir()
+	ast_path := filepath.Join(dir, "e.json")
+	os.WriteFile(ast_path, []byte(test_errors_ast_json), 0644)
+	c2v := test_c2v()
+	out_path := filepath.Join(dir, "e.v")
+	if err := c2v.translate_ast(ast_path, "", out_path); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"e.c:1: unhandled top level declaration (StaticAssertDecl)",
+		"e.c:3: local extern variable `x` is not supported yet (VarDecl)",
+		"e.c:4: unhandled expression (StmtExpr)",
+	}
+	if len(c2v.errors) != len(want) {
+		t.Fatalf("Result: %v, want: %v", c2v.errors, want)
+	}
+	for i, err := range c2v.errors {
+		if err.Error() != want[i] {
+			t.Errorf("Result: %q, want: %q", err.Error(), want[i])
+		}
+	}
+	// the rest of the file is still translated
+	if out, _ := os.ReadFile(out_path); !strings.Contains(string(out), "fn f()") {
+		t.Errorf("Result:\n%s", out)
+	}
+}
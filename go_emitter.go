@@ -0,0 +1,627 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// go_emitter generates Go code (`-target=go`).
+type go_emitter struct {
+	c         *C2V
+	cgo_types map[string]string // the Go names of the C types of a wrapped header
+	cgo_enums map[string]bool   // the Go names of its enums, they're int32 and not C types
+}
+
+// converts a C type to a Go type
+// `int [3]` => `[3]int32`, `char **` => `**byte`, `int (*)(int)` => `func(int32) int32`
+func go_type(c_type string) string {
+	t, err := parse_ctype(c_type)
+	if err != nil {
+		vprintln(err.Error())
+		return trim_space(c_type)
+	}
+	return go_type_name(t)
+}
+
+func go_type_name(t *CType) string {
+	switch t.kind {
+	case ctype_pointer:
+		if t.elem.is_void() {
+			return "unsafe.Pointer"
+		}
+		if t.elem.kind == ctype_func {
+			// Go func values are pointers already
+			return go_type_name(t.elem)
+		}
+		return "*" + go_type_name(t.elem)
+	case ctype_array:
+		return "[" + t.size + "]" + go_type_name(t.elem)
+	case ctype_func:
+		params := []string{}
+		for _, param := range t.params {
+			params = append(params, go_type_name(param))
+		}
+		if t.is_variadic {
+			params = append(params, "...any")
+		}
+		return trim_space(fmt.Sprintf("func(%s) %s", strings.Join(params, ", "), go_type_name(t.elem)))
+	case ctype_record, ctype_enum, ctype_typedef:
+		if prim, ok := c_primitive(t.name); ok && t.kind == ctype_typedef {
+			return go_primitive(prim)
+		}
+		return t.name
+	}
+	prim, _ := c_primitive(t.name)
+	return go_primitive(prim)
+}
+
+func go_zero_value(typ string) string {
+	if typ == "bool" {
+		return "false"
+	}
+	if starts_with(typ, "*") || starts_with(typ, "func(") || typ == "unsafe.Pointer" {
+		return "nil"
+	}
+	switch typ {
+	case "byte", "int", "uintptr", "int8", "uint8", "int16", "uint16", "int32", "uint32",
+		"int64", "uint64", "float32", "float64":
+		return "0"
+	}
+	return typ + "{}"
+}
+
+func (e *go_emitter) ext() string {
+	return ".go"
+}
+
+// The header is generated after the whole file has been translated,
+// since imports depend on what was used.
+func (e *go_emitter) file_header(body string) string {
+	if e.c.is_wrapper {
+		return e.cgo_header(body)
+	}
+	s := "package main\n\n"
+	if contains(body, "C.") {
+		s += "/*\n#include <stdio.h>\n#include <stdlib.h>\n#include <string.h>\n*/\nimport \"C\"\n\n"
+	}
+	if contains(body, "unsafe.") {
+		s += "import \"unsafe\"\n\n"
+	}
+	return s
+}
+
+func (e *go_emitter) globals_header() []string {
+	return []string{"package main\n"}
+}
+
+func (e *go_emitter) type_name(c_type string) string {
+	return go_type(c_type)
+}
+
+func (e *go_emitter) func_decl(fn *FuncDecl) {
+	c := e.c
+	if c.is_wrapper {
+		e.cgo_func_decl(fn)
+		return
+	}
+	if fn.body == nil {
+		// Go has no forward declarations, only definitions are generated
+		return
+	}
+	typ := ""
+	args := []string{}
+	if fn.name != "main" {
+		typ = go_type(fn.ret)
+		for _, param := range fn.params {
+			args = append(args, filter_name(param.name)+" "+go_type(param.typ))
+		}
+		if fn.is_variadic {
+			args = append(args, "args ...any")
+		}
+	}
+	c.genln(trim_space(fmt.Sprintf("func %s(%s) %s", fn.name, strings.Join(args, ", "), typ)) + " {")
+	c.statements(fn.body)
+	c.genln("")
+}
+
+func (e *go_emitter) struct_decl(s *StructDecl) {
+	c := e.c
+	if c.is_wrapper {
+		e.cgo_struct_decl(s)
+		return
+	}
+	if s.is_union {
+		// Go has no unions, all fields get their own storage
+		c.genln("// union")
+	}
+	c.genln(fmt.Sprintf("type %s struct {", s.name))
+	for _, field := range s.fields {
+		c.gen_doc(field.doc)
+		c.genln(fmt.Sprintf("\t%s %s%s", filter_name(field.name), go_type(field.typ), trailing(field.comment)))
+	}
+	c.genln("}\n")
+}
+
+// C enums are ints and are used as ints everywhere, so the enum type is an alias
+// and its values are untyped constants.
+func (e *go_emitter) enum_decl(en *EnumDecl) bool {
+	c := e.c
+	if c.is_wrapper {
+		e.cgo_enum_decl(en)
+		return true
+	}
+	vals := &str_arr{}
+	for _, val := range en.vals {
+		vals.add(filter_name(val.name))
+	}
+	if en.name != "" {
+		if !c.proj.add_enum(c.out_dir(), en.name, vals) {
+			return false
+		}
+		c.genln(fmt.Sprintf("type %s = int32\n", en.name))
+	}
+	c.genln("const (")
+	has_vals := false
+	for _, val := range en.vals {
+		if val.value != nil {
+			has_vals = true
+		}
+	}
+	prev := ""
+	for i, val := range en.vals {
+		name := filter_name(val.name)
+		c.gen_doc(val.doc)
+		c.gen("\t" + name)
+		if val.value != nil {
+			c.gen(" = ")
+			c.skip_parens = true
+			c.expr(val.value)
+			c.skip_parens = false
+		} else if !has_vals {
+			if i == 0 {
+				c.gen(" = iota")
+			}
+		} else if prev == "" {
+			c.gen(" = 0")
+		} else {
+			c.gen(fmt.Sprintf(" = %s + 1", prev))
+		}
+		c.genln(trailing(val.comment))
+		prev = name
+	}
+	c.genln(")\n")
+	return true
+}
+
+func (e *go_emitter) typedef_decl(alias string, c_type string) {
+	if e.c.is_wrapper {
+		e.cgo_typedef_decl(alias)
+		return
+	}
+	e.c.genln(fmt.Sprintf("type %s = %s\n", alias, go_type(c_type)))
+}
+
+func (e *go_emitter) macro_name(name string) string {
+	return name
+}
+
+// The consts are untyped, like the values of the macros
+func (e *go_emitter) macro_consts(ms []*Macro) int {
+	c := e.c
+	lines := []string{}
+	for _, m := range ms {
+		if !c.proj.add_const(c.out_dir(), m.name) {
+			continue
+		}
+		value := macro_expr(m.toks, e.macro_name, "^")
+		if c.is_wrapper {
+			// cgo knows the constant macros of the header
+			value = "C." + m.name
+		}
+		lines = append(lines, fmt.Sprintf("\t%s = %s", m.name, value))
+	}
+	if len(lines) == 0 {
+		return 0
+	}
+	c.genln("const (")
+	for _, line := range lines {
+		c.genln(line)
+	}
+	c.genln(")\n")
+	return len(lines)
+}
+
+const go_int_types = "~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr"
+
+// `#define MAX(a, b) ((a) > (b) ? (a) : (b))` => `func MAX[T ~int | ...](a T, b T) T`
+func (e *go_emitter) macro_fn(m *Macro) bool {
+	c := e.c
+	if !c.proj.add_const(c.out_dir(), m.name) {
+		return false
+	}
+	name_of := func(s string) string {
+		if is_go_keyword(s) {
+			return s + "_"
+		}
+		return s
+	}
+	params := []string{}
+	for _, param := range m.params {
+		params = append(params, name_of(param)+" T")
+	}
+	constraint := go_int_types
+	if !m.int_only {
+		constraint += " | ~float32 | ~float64"
+	}
+	ret := "T"
+	if m.is_bool {
+		ret = "bool"
+	}
+	c.genln(fmt.Sprintf("func %s[T %s](%s) %s {", m.name, constraint, join_strs(params, ", "), ret))
+	if m.is_ternary {
+		c.genln("\tif " + macro_expr(m.cond, name_of, "^") + " {")
+		c.genln("\t\treturn " + macro_expr(m.then, name_of, "^"))
+		c.genln("\t}")
+		c.genln("\treturn " + macro_expr(m.els, name_of, "^"))
+	} else {
+		c.genln("\treturn " + macro_expr(m.toks, name_of, "^"))
+	}
+	c.genln("}\n")
+	return true
+}
+
+func (e *go_emitter) global(g *GlobalDecl) {
+	c := e.c
+	if g.is_extern && g.init == nil && c.is_dir {
+		// defined in another .c file of the same package
+		return
+	}
+	typ := go_type(g.typ)
+	if g.init != nil {
+		c.gen(fmt.Sprintf("var %s = ", g.name))
+		e.convert(g.node.ast_type, g.init)
+		c.genln("\n")
+	} else {
+		c.genln(fmt.Sprintf("var %s %s\n", g.name, typ))
+	}
+}
+
+func (e *go_emitter) var_decl(var_decl *Node, cinit bool) {
+	c := e.c
+	name := filter_name(var_decl.name)
+	typ := go_type(var_decl.ast_type.qualified)
+	if !cinit {
+		c.gen(fmt.Sprintf("var %s %s", name, typ))
+		return
+	}
+	expr := var_decl.try_get_next_child()
+	c.gen(name + " := ")
+	e.convert(var_decl.ast_type, expr)
+}
+
+// C conditions are ints, Go requires bools
+func (e *go_emitter) gen_bool(node *Node) {
+	c := e.c
+	if is_bool_expr(node) {
+		c.expr(node)
+		return
+	}
+	c.gen("(")
+	c.expr(node)
+	if ends_with(node.ast_type.underlying(), "*") {
+		c.gen(") != nil")
+	} else {
+		c.gen(") != 0")
+	}
+}
+
+func is_bool_expr(node *Node) bool {
+	if node.kindof(implicit_cast_expr) || node.kindof(paren_expr) {
+		if len(node.inner) > 0 {
+			return is_bool_expr(node.inner[0])
+		}
+	}
+	if node.kindof(binary_operator) {
+		switch node.opcode {
+		case "<", ">", "<=", ">=", "==", "!=", "&&", "||":
+			return true
+		}
+	}
+	if node.kindof(unary_operator) && node.opcode == "!" {
+		return true
+	}
+	typ := node.ast_type.underlying()
+	return typ == "bool" || typ == "_Bool"
+}
+
+func (e *go_emitter) stmt(node *Node) bool {
+	if node.kindof(switch_stmt) {
+		e.switch_st(node)
+		return true
+	}
+	return false
+}
+
+func (e *go_emitter) expr(node *Node) bool {
+	c := e.c
+	if node.kindof(binary_operator) && (node.opcode == "&&" || node.opcode == "||") {
+		// both operands must be bools in Go
+		e.gen_bool(node.try_get_next_child())
+		c.gen(fmt.Sprintf(" %s ", node.opcode))
+		e.gen_bool(node.try_get_next_child())
+	} else if node.kindof(unary_operator) && (node.opcode == "++" || node.opcode == "--") {
+		// only the postfix statement form exists in Go
+		c.expr(node.try_get_next_child())
+		c.gen(node.opcode)
+	} else if node.kindof(unary_operator) && node.opcode == "!" {
+		c.gen("!(")
+		e.gen_bool(node.try_get_next_child())
+		c.gen(")")
+	} else if node.kindof(unary_operator) && node.opcode == "~" {
+		c.gen("^")
+		c.expr(node.try_get_next_child())
+	} else if node.kindof(string_literal) {
+		// C strings are NUL terminated byte arrays. Some C escapes (`\0`, `\e`, `\12`) are
+		// not valid in Go, so the literal is decoded and quoted again.
+		c.gen(fmt.Sprintf("&[]byte(%s)[0]", strconv.Quote(c_string_bytes(node.value)+"\x00")))
+	} else if node.kindof(unary_expr_or_type_trait_expr) {
+		// sizeof
+		if len(node.inner) > 0 {
+			c.gen("unsafe.Sizeof(")
+			c.expr(node.try_get_next_child())
+			c.gen(")")
+		} else {
+			c.gen(fmt.Sprintf("unsafe.Sizeof(*new(%s))", go_type(node.ast_argument_type.qualified)))
+		}
+	} else if node.kindof(c_style_cast_expr) {
+		e.cast(node.ast_type, node.try_get_next_child())
+	} else if node.kindof(conditional_operator) {
+		e.conditional(node)
+	} else if node.kindof(init_list_expr) {
+		e.init_list_expr(node)
+	} else {
+		return false
+	}
+	return true
+}
+
+// c_string_bytes decodes the spelling of a C string literal: `"a\0\12"` => "a\x00\n"
+func c_string_bytes(lit string) string {
+	if i := strings.IndexByte(lit, '"'); i != -1 {
+		// `u8"..."`, `L"..."`
+		lit = lit[i+1:]
+	}
+	lit = strings.TrimSuffix(lit, `"`)
+	sb := strings.Builder{}
+	for i := 0; i < len(lit); i++ {
+		if lit[i] != '\\' || i+1 == len(lit) {
+			sb.WriteByte(lit[i])
+			continue
+		}
+		i++
+		switch ch := lit[i]; ch {
+		case 'n':
+			sb.WriteByte('\n')
+		case 't':
+			sb.WriteByte('\t')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'a':
+			sb.WriteByte('\a')
+		case 'b':
+			sb.WriteByte('\b')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'v':
+			sb.WriteByte('\v')
+		case 'e', 'E':
+			// GNU
+			sb.WriteByte(0x1b)
+		case 'x':
+			val := 0
+			for i+1 < len(lit) && is_hex_digit(lit[i+1]) {
+				i++
+				val = val*16 + hex_digit_value(lit[i])
+			}
+			sb.WriteByte(byte(val))
+		case 'u', 'U':
+			n := 4
+			if ch == 'U' {
+				n = 8
+			}
+			if i+n < len(lit) {
+				if val, err := strconv.ParseUint(lit[i+1:i+1+n], 16, 32); err == nil {
+					sb.WriteRune(rune(val))
+					i += n
+					break
+				}
+			}
+			sb.WriteByte(ch)
+		default:
+			if ch >= '0' && ch <= '7' {
+				// up to 3 octal digits
+				val := 0
+				for j := 0; j < 3 && i < len(lit) && lit[i] >= '0' && lit[i] <= '7'; j++ {
+					val = val*8 + int(lit[i]-'0')
+					i++
+				}
+				i--
+				sb.WriteByte(byte(val))
+			} else {
+				// `\\`, `\"`, `\'`, `\?`
+				sb.WriteByte(ch)
+			}
+		}
+	}
+	return sb.String()
+}
+
+func is_hex_digit(ch byte) bool {
+	return is_digit(ch) || (ch >= 'a' && ch <= 'f') || (ch >= 'A' && ch <= 'F')
+}
+
+func hex_digit_value(ch byte) int {
+	switch {
+	case is_digit(ch):
+		return int(ch - '0')
+	case ch >= 'a':
+		return int(ch-'a') + 10
+	}
+	return int(ch-'A') + 10
+}
+
+// `(*T)(unsafe.Pointer(x))` is the only way to cast between pointer types in Go
+func (e *go_emitter) cast(t AstJsonType, expr *Node) {
+	c := e.c
+	typ := go_type(t.qualified)
+	if under := go_type(t.underlying()); starts_with(under, "*") {
+		c.gen(fmt.Sprintf("(%s)(unsafe.Pointer(", typ))
+		c.expr(expr)
+		c.gen("))")
+		return
+	}
+	c.gen(typ + "(")
+	c.expr(expr)
+	c.gen(")")
+}
+
+// `T(expr)`, C converts numeric types implicitly, Go doesn't
+func (e *go_emitter) convert(t AstJsonType, expr *Node) {
+	c := e.c
+	typ := go_type(t.qualified)
+	under := go_type(t.underlying())
+	if expr.kindof(init_list_expr) {
+		c.expr(expr)
+		return
+	}
+	if is_null_literal(expr) && go_zero_value(under) == "nil" {
+		c.gen("nil")
+		return
+	}
+	if starts_with(typ, "*") {
+		c.gen("(" + typ + ")(")
+	} else if starts_with(under, "func(") {
+		c.expr(expr)
+		return
+	} else {
+		c.gen(typ + "(")
+	}
+	c.expr(expr)
+	c.gen(")")
+}
+
+// `NULL` is `((void*)0)`, or just `0` with implicit casts
+func is_null_literal(node *Node) bool {
+	for node.kindof(implicit_cast_expr) || node.kindof(c_style_cast_expr) || node.kindof(paren_expr) {
+		if len(node.inner) == 0 {
+			return false
+		}
+		node = node.inner[0]
+	}
+	return node.kindof(integer_literal) && node.value == "0"
+}
+
+// `a ? b : c` has no Go equivalent, a func literal is used instead
+func (e *go_emitter) conditional(node *Node) {
+	c := e.c
+	cond := node.try_get_next_child()
+	case1 := node.try_get_next_child()
+	case2 := node.try_get_next_child()
+	c.gen(fmt.Sprintf("func() %s { if ", go_type(node.ast_type.qualified)))
+	e.gen_bool(cond)
+	c.gen(" { return ")
+	c.expr(case1)
+	c.gen(" }; return ")
+	c.expr(case2)
+	c.gen(" }()")
+}
+
+// Go switch cases don't fall through, so every case that doesn't end with a
+// `break` or a `return` gets an explicit `fallthrough`.
+func (e *go_emitter) switch_st(switch_node *Node) {
+	c := e.c
+	c.inside_switch++
+	expr := switch_node.try_get_next_child()
+	comp_stmt := switch_node.try_get_next_child()
+	c.gen("switch ")
+	c.expr(expr)
+	c.genln(" {")
+	in_case := false
+	terminated := true
+	for _, child := range comp_stmt.inner {
+		if child.kindof(case_stmt) || child.kindof(default_stmt) {
+			if in_case && !terminated {
+				c.out.indent++
+				c.genln("fallthrough")
+				c.out.indent--
+			}
+			body := e.case_label(child)
+			in_case = true
+			terminated = false
+			child = body
+			if child == nil {
+				continue
+			}
+		}
+		if child.kindof(break_stmt) {
+			terminated = true
+			continue
+		}
+		c.out.indent++
+		c.statement(child)
+		c.out.indent--
+		terminated = child.kindof(return_stmt) || child.kindof(goto_stmt)
+	}
+	c.genln("}")
+	c.inside_switch--
+}
+
+// `case 1: case 2: foo();` => `case 1, 2:`, returns the first statement of the case body
+func (e *go_emitter) case_label(node *Node) *Node {
+	c := e.c
+	if node.kindof(default_stmt) {
+		c.genln("default:")
+		return last_child(node)
+	}
+	c.gen("case ")
+	for node.kindof(case_stmt) {
+		c.expr(node.inner[0])
+		body := last_child(node)
+		if body == nil || !body.kindof(case_stmt) {
+			c.genln(":")
+			return body
+		}
+		c.gen(", ")
+		node = body
+	}
+	return nil
+}
+
+func last_child(node *Node) *Node {
+	if len(node.inner) == 0 {
+		return nil
+	}
+	return node.inner[len(node.inner)-1]
+}
+
+// `{1, 2, 3}` => `[3]int32{1, 2, 3}`, `{"Bob", 20}` => `User{&[]byte("Bob\x00")[0], 20}`
+func (e *go_emitter) init_list_expr(node *Node) {
+	c := e.c
+	c.gen(go_type(node.ast_type.qualified) + "{")
+	children := node.inner
+	if len(node.array_filler) > 0 {
+		children = node.array_filler
+	}
+	for i, child := range children {
+		if i > 0 {
+			c.gen(", ")
+		}
+		if child.kindof(implicit_value_init_expr) {
+			c.gen(go_zero_value(go_type(child.ast_type.underlying())))
+		} else {
+			c.expr(child)
+		}
+	}
+	c.gen("}")
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+)
+
+func go_node(kind NodeKind, typ string, inner ...*Node) *Node {
+	return &Node{kind: kind, kind_str: kind.str(), ast_type: AstJsonType{qualified: typ}, inner: inner}
+}
+
+func go_ref(name string, typ string) *Node {
+	n := go_node(decl_ref_expr, typ)
+	n.ref_declaration = RefDeclarationNode{kind: var_decl, name: name}
+	return n
+}
+
+func go_int(value string) *Node {
+	n := go_node(integer_literal, "int")
+	n.value = value
+	return n
+}
+
+func TestGoStringLiterals(t *testing.T) {
+	for _, tc := range []struct {
+		lit  string
+		want string
+	}{
+		{`"%s\n"`, `&[]byte("%s\n\x00")[0]`},
+		// `\0`, `\e` and octal escapes don't exist in Go
+		{`"a\0b\e\12\101"`, `&[]byte("a\x00b\x1b\nA\x00")[0]`},
+		{`"\x41\"\\\?'"`, `&[]byte("A\"\\?'\x00")[0]`},
+		{`u8"\u00e9"`, `&[]byte("é\x00")[0]`},
+	} {
+		c := test_c2v("-target=go")
+		n := go_node(string_literal, "char[4]")
+		n.value = tc.lit
+		c.expr(n)
+		if got := c.out.str(); got != tc.want {
+			t.Errorf("%s: Result: %s, want: %s", tc.lit, got, tc.want)
+		}
+	}
+}
+
+func TestGoCasts(t *testing.T) {
+	c := test_c2v("-target=go")
+	c.expr(go_node(c_style_cast_expr, "unsigned char", go_ref("x", "int")))
+	if got, want := c.out.str(), "uint8(x)"; got != want {
+		t.Errorf("Result: %s, want: %s", got, want)
+	}
+	c.out = code_buffer{}
+	c.expr(go_node(c_style_cast_expr, "char *", go_ref("p", "void *")))
+	if got, want := c.out.str(), "(*byte)(unsafe.Pointer(p))"; got != want {
+		t.Errorf("Result: %s, want: %s", got, want)
+	}
+}
+
+func TestGoLoops(t *testing.T) {
+	c := test_c2v("-target=go")
+	inc := go_node(unary_operator, "int", go_ref("i", "int"))
+	inc.opcode, inc.is_postfix = "++", true
+	cond := go_node(binary_operator, "int", go_ref("i", "int"), go_int("3"))
+	cond.opcode = "<"
+	c.statement(go_node(while_stmt, "", cond, go_node(compound_stmt, "", inc)))
+	if got, want := c.out.str(), "for i < 3 {\n\ti++\n}\n"; got != want {
+		t.Errorf("Result: %q, want: %q", got, want)
+	}
+	c.out = code_buffer{}
+	// a C condition is an int
+	inc.current_child_id = 0
+	c.statement(go_node(while_stmt, "", go_ref("n", "int"), go_node(compound_stmt, "", inc)))
+	if got, want := c.out.str(), "for (n) != 0 {\n\ti++\n}\n"; got != want {
+		t.Errorf("Result: %q, want: %q", got, want)
+	}
+}
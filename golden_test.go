@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/*.golden with the current output")
+
+// TestGolden translates each testdata/<name>.json (the AST of testdata/<name>.c) to V and Go
+// and compares the output with testdata/<name>.<target>.golden. The ASTs of headers
+// (testdata/<name>.h) are translated in wrapper mode.
+// `go test -run Golden *.go -update` rewrites the goldens, and dumps the ASTs again if
+// clang is installed.
+func TestGolden(t *testing.T) {
+	asts, _ := filepath.Glob(filepath.Join("testdata", "*.json"))
+	if len(asts) == 0 {
+		t.Fatal("no testdata/*.json")
+	}
+	for _, ast_path := range asts {
+		name := strings.TrimSuffix(filepath.Base(ast_path), ".json")
+		c_file := strings.TrimSuffix(ast_path, ".json") + ".c"
+		is_wrapper := false
+		h_file := strings.TrimSuffix(ast_path, ".json") + ".h"
+		if _, err := os.Stat(h_file); err == nil {
+			c_file = h_file
+			is_wrapper = true
+		}
+		if *update && find_clang_in_path() != "" {
+			c2v := test_c2v()
+			if err := c2v.dump_ast(c_file, ast_path); err != nil {
+				t.Fatal(err)
+			}
+			if err := c2v.dump_macros(c_file, macros_path_of(ast_path)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, target := range []string{"v", "go"} {
+			t.Run(name+"/"+target, func(t *testing.T) {
+				c2v := test_c2v("-target=" + target)
+				if is_wrapper {
+					c2v.is_wrapper = true
+					c2v.wrapper_module_name = module_name_of(c_file)
+				}
+				out_path := filepath.Join(t.TempDir(), name+c2v.emitter.ext())
+				if err := c2v.translate_ast(ast_path, c_file, out_path); err != nil {
+					t.Fatal(err)
+				}
+				got, _ := os.ReadFile(out_path)
+				golden := filepath.Join("testdata", name+"."+target+".golden")
+				if *update {
+					os.WriteFile(golden, got, 0644)
+					return
+				}
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatalf("%v, run `go test -run Golden *.go -update`", err)
+				}
+				if string(got) != string(want) {
+					t.Errorf("the output differs from %s:\n%s", golden, got)
+				}
+			})
+		}
+	}
+}
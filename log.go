@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// LogLevel is set with `-q`, `-v` and `-vv`. All the logs go to stderr, so that they never
+// mix with generated code printed to stdout.
+type LogLevel int
+
+const (
+	log_quiet LogLevel = iota // only errors
+	log_info                  // one line per translated file, the default
+	log_debug                 // `-v`: clang commands, configuration
+	log_trace                 // `-vv`: every node the translator visits
+)
+
+var log_level = log_info
+
+func logf(level LogLevel, format string, a ...any) {
+	if level <= log_level {
+		fmt.Fprintf(os.Stderr, format, a...)
+	}
+}
+
+func infof(format string, a ...any) {
+	logf(log_info, format, a...)
+}
+
+func debugf(format string, a ...any) {
+	logf(log_debug, format, a...)
+}
+
+// vprintln, vprintf and vprint trace the translation of the nodes
+func vprintln(s string) {
+	logf(log_trace, "%s\n", s)
+}
+
+func vprintf(format string, a ...any) {
+	logf(log_trace, format, a...)
+}
+
+func vprint(s string) {
+	logf(log_trace, "%s", s)
+}
+
+// eprintln prints an error, even with `-q`
+func eprintln(s string) {
+	fmt.Fprintln(os.Stderr, s)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLogLevels(t *testing.T) {
+	old_level, old_stderr := log_level, os.Stderr
+	defer func() { log_level, os.Stderr = old_level, old_stderr }()
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+	test_c2v("-v")
+	infof("info %d\n", 1)
+	debugf("debug %s\n", "x")
+	vprintf("trace %v\n", true)
+	eprintln("error")
+	w.Close()
+	out, _ := io.ReadAll(r)
+	if want := "info 1\ndebug x\nerror\n"; string(out) != want {
+		t.Errorf("Result: %q, want: %q", out, want)
+	}
+}
+
+func TestVerboseDoesntChangeOutput(t *testing.T) {
+	old_level, old_stderr := log_level, os.Stderr
+	defer func() { log_level, os.Stderr = old_level, old_stderr }()
+	os.Stderr, _ = os.Open(os.DevNull)
+	outs := []string{}
+	for _, flag := range []string{"-q", "-vv"} {
+		out_path := filepath.Join(t.TempDir(), "decls.v")
+		c2v := test_c2v(flag)
+		if err := c2v.translate_ast(filepath.Join("testdata", "decls.json"), filepath.Join("testdata", "decls.c"), out_path); err != nil {
+			t.Fatal(err)
+		}
+		out, _ := os.ReadFile(out_path)
+		outs = append(outs, string(out))
+	}
+	if outs[0] != outs[1] {
+		t.Errorf("with -vv:\n%s\nwith -q:\n%s", outs[1], outs[0])
+	}
+}
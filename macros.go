@@ -0,0 +1,625 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Clang's AST has no macros: their uses are expanded and the `#define`s are gone. So the
+// macros are dumped separately with `clang -dM -E` into file.macros next to file.json.
+// The ones defined in the translated file become consts, and the function-like ones
+// whose body is an expression of their params become generic inline functions.
+
+type Macro struct {
+	name   string
+	params []string // nil for object-like macros
+	body   string
+	line   int // of the `#define` in the translated file
+	// set by classify_const()/classify_fn()
+	typ        string     // the C type of a constant: int, unsigned long, double, char *
+	toks       []MacroTok // the body, the numbers are normalized
+	is_bool    bool       // the body of a function-like macro is a comparison
+	int_only   bool       // the body uses % << >> & | ^ ~, the params can't be floats
+	is_ternary bool       // the body is `cond ? a : b`, split into cond, then and els
+	cond       []MacroTok
+	then       []MacroTok
+	els        []MacroTok
+}
+
+func (m *Macro) is_fn() bool {
+	return m.params != nil
+}
+
+type MacroTokKind int
+
+const (
+	mtok_num MacroTokKind = iota
+	mtok_str
+	mtok_char
+	mtok_ident
+	mtok_op
+)
+
+type MacroTok struct {
+	kind MacroTokKind
+	s    string
+}
+
+// the macros file of an AST: `a.json` => `a.macros`
+func macros_path_of(ast_path string) string {
+	return strings.TrimSuffix(ast_path, ".json") + ".macros"
+}
+
+// parse_macros reads the output of `clang -dM -E`: a `#define NAME body` per line
+func parse_macros(text string) []*Macro {
+	macros := []*Macro{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if !starts_with(line, "#define ") {
+			continue
+		}
+		rest := line[len("#define "):]
+		i := 0
+		for i < len(rest) && is_ident_char(rest[i]) {
+			i++
+		}
+		m := &Macro{name: rest[:i]}
+		rest = rest[i:]
+		if starts_with(rest, "(") {
+			// `#define F(a, b)`, there's no space before the params
+			end := strings.Index(rest, ")")
+			if end == -1 {
+				continue
+			}
+			m.params = []string{}
+			for _, param := range strings.Split(rest[1:end], ",") {
+				if param = trim_space(param); param != "" {
+					m.params = append(m.params, param)
+				}
+			}
+			rest = rest[end+1:]
+		}
+		m.body = trim_space(rest)
+		macros = append(macros, m)
+	}
+	return macros
+}
+
+var define_re = regexp.MustCompile(`^[ \t]*#[ \t]*define[ \t]+([A-Za-z_][A-Za-z0-9_]*)`)
+
+// defined_macros returns the lines of the `#define`s of a C file
+func defined_macros(src string) map[string]int {
+	lines := map[string]int{}
+	for i, line := range strings.Split(src, "\n") {
+		if m := define_re.FindStringSubmatch(line); m != nil {
+			if _, ok := lines[m[1]]; !ok {
+				lines[m[1]] = i + 1
+			}
+		}
+	}
+	return lines
+}
+
+var macro_ops = []string{"<<=", ">>=", "...", "<<", ">>", "<=", ">=", "==", "!=", "&&", "||", "++", "--",
+	"->", "##", "+=", "-=", "*=", "/=", "%=", "&=", "|=", "^="}
+
+func tokenize_macro(body string) ([]MacroTok, error) {
+	toks := []MacroTok{}
+	for i := 0; i < len(body); {
+		ch := body[i]
+		switch {
+		case ch == ' ' || ch == '\t':
+			i++
+		case is_digit(ch) || (ch == '.' && i+1 < len(body) && is_digit(body[i+1])):
+			// a preprocessing number: `0x1fu`, `1.5e-3f`
+			j := i + 1
+			for j < len(body) {
+				if (body[j] == '+' || body[j] == '-') && strings.ContainsRune("eEpP", rune(body[j-1])) {
+					j++
+				} else if is_ident_char(body[j]) || body[j] == '.' {
+					j++
+				} else {
+					break
+				}
+			}
+			toks = append(toks, MacroTok{mtok_num, body[i:j]})
+			i = j
+		case is_ident_char(ch):
+			j := i
+			for j < len(body) && is_ident_char(body[j]) {
+				j++
+			}
+			toks = append(toks, MacroTok{mtok_ident, body[i:j]})
+			i = j
+		case ch == '"' || ch == '\'':
+			j := i + 1
+			for j < len(body) && body[j] != ch {
+				if body[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(body) {
+				return nil, fmt.Errorf("unterminated literal")
+			}
+			kind := mtok_str
+			if ch == '\'' {
+				kind = mtok_char
+			}
+			toks = append(toks, MacroTok{kind, body[i : j+1]})
+			i = j + 1
+		default:
+			op := body[i : i+1]
+			for _, o := range macro_ops {
+				if starts_with(body[i:], o) {
+					op = o
+					break
+				}
+			}
+			toks = append(toks, MacroTok{mtok_op, op})
+			i += len(op)
+		}
+	}
+	return toks, nil
+}
+
+func is_digit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+// c_number splits a C number into its V/Go spelling and its C type:
+// `0x10u` => `0x10`, `unsigned int`; `010` => `0o10`, `int`; `.5f` => `0.5`, `float`
+func c_number(s string) (string, string, bool) {
+	lower := to_lower(s)
+	if !starts_with(lower, "0x") && strings.ContainsAny(lower, ".e") {
+		typ := "double"
+		if ends_with(lower, "f") {
+			typ = "float"
+			s = s[:len(s)-1]
+		} else if ends_with(lower, "l") {
+			s = s[:len(s)-1]
+		}
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return "", "", false
+		}
+		if starts_with(s, ".") {
+			s = "0" + s
+		}
+		s = strings.Replace(s, ".e", ".0e", 1)
+		s = strings.Replace(s, ".E", ".0E", 1)
+		if ends_with(s, ".") {
+			s += "0"
+		}
+		return s, typ, true
+	}
+	suffix := ""
+	for len(s) > 0 && strings.ContainsRune("uUlL", rune(s[len(s)-1])) {
+		suffix = to_lower(s[len(s)-1:]) + suffix
+		s = s[:len(s)-1]
+	}
+	val, err := strconv.ParseUint(s, 0, 64)
+	if err != nil {
+		return "", "", false
+	}
+	if len(s) > 1 && s[0] == '0' && is_digit(s[1]) {
+		// V doesn't have C's octal numbers
+		s = "0o" + s[1:]
+	}
+	typ := ""
+	switch suffix {
+	case "":
+		typ = "int"
+		if val > math.MaxInt32 {
+			typ = "long"
+		}
+	case "u":
+		typ = "unsigned int"
+		if val > math.MaxUint32 {
+			typ = "unsigned long"
+		}
+	case "l":
+		typ = "long"
+	case "ul", "lu":
+		typ = "unsigned long"
+	case "ll":
+		typ = "long long"
+	case "ull", "llu":
+		typ = "unsigned long long"
+	default:
+		return "", "", false
+	}
+	return s, typ, true
+}
+
+var const_macro_ops = map[string]bool{"+": true, "-": true, "*": true, "/": true, "%": true,
+	"<<": true, ">>": true, "&": true, "|": true, "^": true, "~": true, "(": true, ")": true}
+
+var bool_macro_ops = map[string]bool{"==": true, "!=": true, "<": true, ">": true, "<=": true,
+	">=": true, "&&": true, "||": true}
+
+var int_macro_ops = map[string]bool{"%": true, "<<": true, ">>": true, "&": true, "|": true,
+	"^": true, "~": true}
+
+// normalize_numbers replaces the C numbers with their V/Go spelling, and returns their types
+func normalize_numbers(toks []MacroTok) ([]string, bool) {
+	types := []string{}
+	for i, tok := range toks {
+		if tok.kind != mtok_num {
+			continue
+		}
+		s, typ, ok := c_number(tok.s)
+		if !ok {
+			return nil, false
+		}
+		toks[i].s = s
+		types = append(types, typ)
+	}
+	return types, true
+}
+
+// classify_const checks that an object-like macro is a constant: a number, a string, or
+// an expression of numbers and other constants. It returns why it isn't.
+func classify_const(m *Macro, toks []MacroTok, known map[string]*Macro) string {
+	is_str := true
+	for _, tok := range toks {
+		is_str = is_str && tok.kind == mtok_str
+	}
+	if is_str {
+		// `"a" "b"` => "ab"
+		s := ""
+		for _, tok := range toks {
+			s += tok.s[1 : len(tok.s)-1]
+		}
+		m.typ = "char *"
+		m.toks = []MacroTok{{mtok_str, `"` + s + `"`}}
+		return ""
+	}
+	toks = append([]MacroTok{}, toks...)
+	types, ok := normalize_numbers(toks)
+	if !ok {
+		return "not a number"
+	}
+	for _, tok := range toks {
+		switch tok.kind {
+		case mtok_ident:
+			ref, ok := known[tok.s]
+			if !ok || ref.is_fn() || ref.typ == "char *" {
+				return fmt.Sprintf("not a constant, uses `%s`", tok.s)
+			}
+			types = append(types, ref.typ)
+		case mtok_op:
+			if !const_macro_ops[tok.s] {
+				return "not a constant expression"
+			}
+		case mtok_str, mtok_char:
+			return "not a constant expression"
+		}
+	}
+	if len(types) == 0 {
+		return "not a constant expression"
+	}
+	m.typ = types[0]
+	for _, typ := range types[1:] {
+		if typ == "double" || typ == "float" {
+			m.typ = "double"
+		} else if m.typ == "int" {
+			m.typ = typ
+		}
+	}
+	m.toks = toks
+	return ""
+}
+
+// classify_fn checks that the body of a function-like macro is an expression of its
+// params: `((a) > (b) ? (a) : (b))`. It returns why it isn't.
+func classify_fn(m *Macro, toks []MacroTok, known map[string]*Macro) string {
+	if len(m.params) == 0 {
+		return "no params"
+	}
+	for _, param := range m.params {
+		if param == "..." || ends_with(param, "...") {
+			return "variadic macro"
+		}
+	}
+	toks = append([]MacroTok{}, toks...)
+	if _, ok := normalize_numbers(toks); !ok {
+		return "not a number"
+	}
+	// the parens of the calls of other macros, where `,` is allowed
+	calls := []bool{}
+	for i, tok := range toks {
+		switch tok.kind {
+		case mtok_num:
+		case mtok_ident:
+			if ArrayContains(tok.s, m.params) {
+				continue
+			}
+			ref, ok := known[tok.s]
+			if !ok || ref.typ == "char *" {
+				return fmt.Sprintf("not an expression of its params, uses `%s`", tok.s)
+			}
+			if ref.is_fn() && (i+1 == len(toks) || toks[i+1].s != "(") {
+				return fmt.Sprintf("uses `%s` without calling it", tok.s)
+			}
+		case mtok_op:
+			switch {
+			case tok.s == "(":
+				calls = append(calls, i > 0 && toks[i-1].kind == mtok_ident)
+			case tok.s == ")":
+				if len(calls) == 0 {
+					return "unbalanced parens"
+				}
+				calls = calls[:len(calls)-1]
+			case tok.s == ",":
+				if len(calls) == 0 || !calls[len(calls)-1] {
+					return "uses the comma operator"
+				}
+			case tok.s == "?" || tok.s == ":":
+			case int_macro_ops[tok.s]:
+				m.int_only = true
+			case !const_macro_ops[tok.s] && !bool_macro_ops[tok.s]:
+				return fmt.Sprintf("not an expression, uses `%s`", tok.s)
+			}
+		default:
+			return "not an expression of numbers"
+		}
+	}
+	if len(calls) > 0 {
+		return "unbalanced parens"
+	}
+	body := strip_macro_parens(toks)
+	question, colon := -1, -1
+	depth := 0
+	for i, tok := range body {
+		switch tok.s {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		case "?":
+			if depth > 0 || question != -1 {
+				return "nested `?:`"
+			}
+			question = i
+		case ":":
+			if depth > 0 || colon != -1 {
+				return "nested `?:`"
+			}
+			colon = i
+		}
+	}
+	if question != -1 || colon != -1 {
+		if question == -1 || colon < question {
+			return "not an expression"
+		}
+		m.is_ternary = true
+		m.cond = strip_macro_parens(body[:question])
+		m.then = strip_macro_parens(body[question+1 : colon])
+		m.els = strip_macro_parens(body[colon+1:])
+	} else {
+		depth = 0
+		for _, tok := range body {
+			if tok.s == "(" {
+				depth++
+			} else if tok.s == ")" {
+				depth--
+			} else if depth == 0 && tok.kind == mtok_op && bool_macro_ops[tok.s] {
+				m.is_bool = true
+			}
+		}
+	}
+	m.toks = body
+	return ""
+}
+
+// strip_macro_parens removes the parens around a whole body: `((a) * (b))` => `(a) * (b)`
+func strip_macro_parens(toks []MacroTok) []MacroTok {
+	for len(toks) >= 2 && toks[0].s == "(" && toks[len(toks)-1].s == ")" {
+		depth := 0
+		for i, tok := range toks {
+			if tok.s == "(" {
+				depth++
+			} else if tok.s == ")" {
+				depth--
+			}
+			if depth == 0 && i < len(toks)-1 {
+				// `(a) + (b)`
+				return toks
+			}
+		}
+		toks = toks[1 : len(toks)-1]
+	}
+	return toks
+}
+
+// load_macros reads the macros dumped next to an AST, the file is optional
+func (c *C2V) load_macros(ast_path string) error {
+	c.macros = nil
+	text, err := os.ReadFile(macros_path_of(ast_path))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.macros = parse_macros(string(text))
+	return nil
+}
+
+// translatable_macros returns the macros defined in the translated file that can be
+// translated, in the order of their definitions. The others are reported as skipped.
+func (c *C2V) translatable_macros() []*Macro {
+	lines := defined_macros(c.c_file_contents)
+	file_macros := []*Macro{}
+	for _, m := range c.macros {
+		line, ok := lines[m.name]
+		if !ok || (m.body == "" && !m.is_fn()) {
+			// defined in a header or by the compiler, or a flag like `#define FOO_H`
+			continue
+		}
+		m.line = line
+		file_macros = append(file_macros, m)
+	}
+	sort.SliceStable(file_macros, func(i, j int) bool {
+		return file_macros[i].line < file_macros[j].line
+	})
+	todo := []*Macro{}
+	toks := map[*Macro][]MacroTok{}
+	reasons := map[*Macro]string{}
+	for _, m := range file_macros {
+		t, err := tokenize_macro(m.body)
+		if err != nil {
+			reasons[m] = err.Error()
+			continue
+		}
+		toks[m] = t
+		todo = append(todo, m)
+	}
+	// A macro can use the macros defined after it, so the macros are classified until
+	// no more of them can be.
+	known := map[string]*Macro{}
+	for progress := true; progress; {
+		progress = false
+		rest := []*Macro{}
+		for _, m := range todo {
+			reason := ""
+			if m.is_fn() {
+				reason = classify_fn(m, toks[m], known)
+			} else {
+				reason = classify_const(m, toks[m], known)
+			}
+			if reason == "" {
+				known[m.name] = m
+				delete(reasons, m)
+				progress = true
+			} else {
+				reasons[m] = reason
+				rest = append(rest, m)
+			}
+		}
+		todo = rest
+	}
+	macros := []*Macro{}
+	for _, m := range file_macros {
+		if known[m.name] == m {
+			macros = append(macros, m)
+		} else if reason, ok := reasons[m]; ok {
+			c.report.Skipped = append(c.report.Skipped, SkippedDecl{
+				Name:     m.name,
+				Reason:   "macro: " + reason,
+				Location: fmt.Sprintf("%s:%d", c.cur_file, m.line),
+			})
+		}
+	}
+	return macros
+}
+
+// macro_decls generates the macros of the file, before its declarations
+func (c *C2V) macro_decls() {
+	consts := []*Macro{}
+	fns := []*Macro{}
+	for _, m := range c.translatable_macros() {
+		if m.is_fn() {
+			fns = append(fns, m)
+		} else {
+			consts = append(consts, m)
+		}
+	}
+	first_line := 0
+	for _, m := range append(append([]*Macro{}, consts...), fns...) {
+		if first_line == 0 || m.line < first_line {
+			first_line = m.line
+		}
+	}
+	if first_line > 0 {
+		// the comments at the top of the file (the license) stay before the consts
+		c.gen_comments_before_line(first_line)
+	}
+	c.macro_consts = map[string]*Macro{}
+	for _, m := range consts {
+		c.macro_consts[m.name] = m
+	}
+	if len(consts) > 0 {
+		c.report.Macros += c.emitter.macro_consts(consts)
+	}
+	for _, m := range fns {
+		if c.emitter.macro_fn(m) {
+			c.report.Macros++
+		}
+	}
+}
+
+// macro_at returns the constant a node was expanded from: `return BUFSIZE;` has an
+// IntegerLiteral whose location is `BUFSIZE` in the C file, while its spelling is the
+// `1024` of the `#define`. Only whole expansions whose type fits the const are replaced.
+func (c *C2V) macro_at(node *Node) *Macro {
+	if len(c.macro_consts) == 0 || c.returning_bool {
+		return nil
+	}
+	begin, end := node.range0.begin, node.range0.end
+	if begin.spelling_file.path == "" || begin.offset != end.offset {
+		return nil
+	}
+	m := c.macro_consts[c.source_slice(node)]
+	if m == nil || !c.macro_fits(node.ast_type, m) {
+		return nil
+	}
+	return m
+}
+
+// macro_fits reports whether a macro const can stand for a number of type t. The untyped
+// consts (all of Go's, V's int and double ones) also fit the typedefs: `size_t n = BUFSIZE;`
+func (c *C2V) macro_fits(t AstJsonType, m *Macro) bool {
+	if m.typ == "char *" {
+		return false
+	}
+	if t.underlying() == m.typ || c.emitter.type_name(t.qualified) == c.emitter.type_name(m.typ) {
+		return true
+	}
+	if c.target != "go" && m.typ != "int" && m.typ != "double" {
+		return false
+	}
+	prim, ok := c_primitive(strings.TrimPrefix(t.underlying(), "const "))
+	if !ok || prim.kind == prim_bool || prim.kind == prim_void {
+		return false
+	}
+	// a float const can't be truncated to an int
+	return prim.kind == prim_float || (m.typ != "float" && m.typ != "double")
+}
+
+// macro_expr renders the tokens of a macro body, name_of translates the params and the
+// names of the other macros
+func macro_expr(toks []MacroTok, name_of func(string) string, complement string) string {
+	sb := strings.Builder{}
+	for i, tok := range toks {
+		s := tok.s
+		if tok.kind == mtok_ident {
+			s = name_of(s)
+		} else if s == "~" {
+			s = complement
+		}
+		if i > 0 {
+			prev := toks[i-1]
+			is_call := tok.s == "(" && prev.kind == mtok_ident
+			if !is_call && prev.s != "(" && tok.s != ")" && tok.s != "," && !is_unary_macro_op(toks, i-1) {
+				sb.WriteByte(' ')
+			}
+		}
+		sb.WriteString(s)
+	}
+	return sb.String()
+}
+
+// is_unary_macro_op reports whether toks[i] is a prefix `-`, `+` or `~`
+func is_unary_macro_op(toks []MacroTok, i int) bool {
+	tok := toks[i]
+	if tok.kind != mtok_op || (tok.s != "-" && tok.s != "+" && tok.s != "~") {
+		return false
+	}
+	return tok.s == "~" || i == 0 || (toks[i-1].kind == mtok_op && toks[i-1].s != ")")
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMacros(t *testing.T) {
+	macros := parse_macros("#define A 1\n#define F(a,b) ((a) + (b))\n#define G (1)\n#define E\n")
+	if len(macros) != 4 {
+		t.Fatalf("Result: %d macros, want 4", len(macros))
+	}
+	if m := macros[1]; m.name != "F" || !reflect.DeepEqual(m.params, []string{"a", "b"}) || m.body != "((a) + (b))" {
+		t.Errorf("Result: %+v", m)
+	}
+	// a space before the paren: an object-like macro
+	if m := macros[2]; m.is_fn() || m.body != "(1)" {
+		t.Errorf("Result: %+v", m)
+	}
+}
+
+func TestCNumber(t *testing.T) {
+	for c, want := range map[string][2]string{
+		"1024":       {"1024", "int"},
+		"0x0fu":      {"0x0f", "unsigned int"},
+		"010":        {"0o10", "int"},
+		"3000000000": {"3000000000", "long"},
+		"1UL":        {"1", "unsigned long"},
+		"1.5f":       {"1.5", "float"},
+		".5":         {"0.5", "double"},
+		"1.e3":       {"1.0e3", "double"},
+	} {
+		s, typ, ok := c_number(c)
+		if !ok || s != want[0] || typ != want[1] {
+			t.Errorf("c_number(%q) = %q, %q, %v, want %q", c, s, typ, ok, want)
+		}
+	}
+	if _, _, ok := c_number("0x1q"); ok {
+		t.Errorf("0x1q is not a number")
+	}
+}
+
+func TestClassifyMacros(t *testing.T) {
+	known := map[string]*Macro{}
+	classify := func(def string) (*Macro, string) {
+		m := parse_macros("#define " + def)[0]
+		toks, err := tokenize_macro(m.body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reason := ""
+		if m.is_fn() {
+			reason = classify_fn(m, toks, known)
+		} else {
+			reason = classify_const(m, toks, known)
+		}
+		if reason == "" {
+			known[m.name] = m
+		}
+		return m, reason
+	}
+	if m, reason := classify("N 4"); reason != "" || m.typ != "int" {
+		t.Errorf("Result: %q %q", reason, m.typ)
+	}
+	if m, reason := classify("HALF (N / 2.0)"); reason != "" || m.typ != "double" {
+		t.Errorf("Result: %q %q", reason, m.typ)
+	}
+	if _, reason := classify("SIZE sizeof(int)"); reason == "" {
+		t.Errorf("sizeof is not a constant")
+	}
+	m, reason := classify("CLAMP(x, lo) ((x) < (lo) ? (lo) : (x) * N)")
+	if reason != "" || !m.is_ternary {
+		t.Fatalf("Result: %q %+v", reason, m)
+	}
+	name_of := func(s string) string { return s }
+	if got := macro_expr(m.els, name_of, "^"); got != "(x) * N" {
+		t.Errorf("Result: %q", got)
+	}
+	if m, reason := classify("NEG(x) (-(x) & ~1)"); reason != "" || !m.int_only ||
+		macro_expr(m.toks, name_of, "^") != "-(x) & ^1" {
+		t.Errorf("Result: %q %q", reason, macro_expr(m.toks, name_of, "^"))
+	}
+	for _, def := range []string{"INC(x) ((x)++)", "FIRST(a, b) (a, b)", "NEST(a) (a ? (a ? 1 : 2) : 3)",
+		"P(...) f(__VA_ARGS__)"} {
+		if _, reason := classify(def); reason == "" {
+			t.Errorf("%s must not be translated", def)
+		}
+	}
+}
+
+func TestMacroFits(t *testing.T) {
+	size_t := AstJsonType{qualified: "size_t", desugared_qualified: "unsigned long"}
+	angle_t := AstJsonType{qualified: "angle_t", desugared_qualified: "unsigned int"}
+	for _, tc := range []struct {
+		target string
+		typ    AstJsonType
+		macro  string
+		want   bool
+	}{
+		{"v", size_t, "16UL", true},
+		{"v", size_t, "16", true},
+		{"v", angle_t, "16U", true},
+		{"v", angle_t, "16UL", false},
+		{"v", AstJsonType{qualified: "uint32_t", desugared_qualified: "unsigned int"}, "16U", true},
+		{"go", size_t, "16U", true},
+		{"go", angle_t, "1.5", false},
+		{"go", AstJsonType{qualified: "float"}, "16", true},
+		{"go", AstJsonType{qualified: "char *"}, "0", false},
+		{"go", AstJsonType{qualified: "char *"}, `"s"`, false},
+	} {
+		c := test_c2v("-target=" + tc.target)
+		m := parse_macros("#define N " + tc.macro)[0]
+		toks, err := tokenize_macro(m.body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reason := classify_const(m, toks, map[string]*Macro{}); reason != "" {
+			t.Fatal(reason)
+		}
+		if got := c.macro_fits(tc.typ, m); got != tc.want {
+			t.Errorf("%s: %s in a %s: Result: %v, want: %v", tc.target, tc.macro, tc.typ.qualified, got, tc.want)
+		}
+	}
+}
+
+func TestReportCountsGeneratedMacros(t *testing.T) {
+	c2v := test_c2v()
+	c2v.is_dir = true
+	counts := []int{}
+	for i := 0; i < 2; i++ {
+		c := c2v.fork()
+		c.c_file_contents = "#define N 1\n#define TWICE(x) ((x) * 2)\n"
+		c.macros = parse_macros(c.c_file_contents)
+		c.macro_decls()
+		counts = append(counts, c.report.Macros)
+	}
+	// the second file shares the macros of the first one
+	if counts[0] != 2 || counts[1] != 0 {
+		t.Errorf("Result: %v macros, want: [2 0]", counts)
+	}
+}
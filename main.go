@@ -3,56 +3,121 @@ package main
 
 import (
 	"fmt"
-	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
 func main() {
-	//fmt.Println("Hello World!")
-	//AppendComma(`D:\tmp\AST\c2v-master\src\aaa.txt`)
-	if len(os.Args) < 2 {
-		eprintln("Usage:")
-		eprintln("  c2v file.c")
-		eprintln("  c2v wrapper file.h")
-		eprintln("  c2v folder/")
-		return
+	cmd, flags, path, err := parse_command_line(os.Args[1:])
+	if err != nil {
+		eprintln(err.Error())
+		eprintln("Run `c2v help` for the usage.")
+		os.Exit(2)
 	}
-
-	path := os.Args[len(os.Args)-1] // last
-	if _, err := os.Stat(path); err == nil {
-		//fmt.Printf("File exists\n");
-	} else {
-		fmt.Printf(`"%s" does not exist\n`, path)
+	switch cmd {
+	case "help":
+		fmt.Println(usage())
 		return
+	case "version":
+		fmt.Println(version_string())
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		eprintln(fmt.Sprintf("%q does not exist", path))
+		os.Exit(1)
 	}
 
-	c2v := new_c2v(os.Args)
-	println("C to V translator ${version}")
+	c2v := new_c2v(flags)
+	c2v.is_wrapper = cmd == "wrapper"
+	if c2v.is_wrapper && c2v.wrapper_module_name == "" {
+		c2v.wrapper_module_name = module_name_of(path)
+	}
+	c2v.check_only = cmd == "check"
+	infof("C to V translator %s\n", version)
 	c2v.translation_start_ticks = time.Now().UnixMicro()
 
 	fi, _ := os.Stat(path)
+	c2v.is_dir = fi.IsDir()
+	c2v.set_project_folder(path)
+	if err := c2v.handle_configuration(); err != nil {
+		eprintln(err.Error())
+		os.Exit(1)
+	}
+	if err := c2v.load_compile_commands(); err != nil {
+		eprintln(err.Error())
+		os.Exit(1)
+	}
+	if cmd == "dump-ast" {
+		if err := c2v.dump_asts(path); err != nil {
+			eprintln(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
 	if fi.IsDir() {
-		files, err := ioutil.ReadDir(path)
+		paths, err := c2v.find_c_files(c2v.project_folder)
 		if err != nil {
-			log.Fatal(err)
+			eprintln(err.Error())
+			os.Exit(1)
 		}
-
-		for _, f := range files {
-			if is_c_file(f.Name()) {
-				c2v.translate_file(f.Name())
-			}
+		c2v.translate_files(paths)
+		if err := c2v.save_globals(); err != nil {
+			eprintln(err.Error())
+			os.Exit(1)
 		}
-		c2v.save_globals()
 	} else {
 		c2v.translate_file(path)
 	}
-	delta_ticks := time.Now().UnixMicro() - c2v.translation_start_ticks
-	fmt.Printf("Translated %v files in %v ms.\n", c2v.translations, delta_ticks)
+	delta_ticks := (time.Now().UnixMicro() - c2v.translation_start_ticks) / 1000
+	infof("Translated %v files in %v ms.\n", c2v.proj.translations, delta_ticks)
+	if c2v.report_path != "" {
+		if err := c2v.write_report(c2v.report_path, delta_ticks); err != nil {
+			eprintln(err.Error())
+			os.Exit(1)
+		}
+	}
+	if c2v.proj.error_count() > 0 {
+		eprintln(c2v.proj.error_summary())
+		os.Exit(1)
+	}
 }
 
 func is_c_file(filename string) bool {
 	return filepath.Ext(filename) == ".c"
 }
+
+// dump_asts writes file.json and file.macros next to each file.c (or into `-o dir`) for `-offline`
+func (c2v *C2V) dump_asts(path string) error {
+	paths := []string{path}
+	if c2v.is_dir {
+		var err error
+		if paths, err = c2v.find_c_files(c2v.project_folder); err != nil {
+			return err
+		}
+	}
+	failed := 0
+	for _, c_file := range paths {
+		ast_path := strings.TrimSuffix(c2v.out_path(c_file), c2v.emitter.ext()) + ".json"
+		if err := os.MkdirAll(filepath.Dir(ast_path), 0755); err != nil {
+			return err
+		}
+		c2v.set_config_overrides_for_file(c_file)
+		if err := c2v.dump_ast(c_file, ast_path); err != nil {
+			eprintln(err.Error())
+			failed++
+			continue
+		}
+		if err := c2v.dump_macros(c_file, macros_path_of(ast_path)); err != nil {
+			eprintln(err.Error())
+			failed++
+			continue
+		}
+		infof("  %s => %s\n", c_file, ast_path)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files could not be parsed", failed, len(paths))
+	}
+	return nil
+}
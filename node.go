@@ -1,7 +1,6 @@
 package main
 
 import (
-	"fmt"
 	"strings"
 )
 
@@ -33,6 +32,7 @@ type Node struct {
 	current_child_id     int
 	is_builtin_type      bool
 	redeclarations_count int // increased when some *other* Node had previous_decl == this Node.id
+	dropped_builtins     int // of the TranslationUnitDecl, see json_decode_stream()
 }
 
 type NodeLocation struct {
@@ -45,9 +45,14 @@ type NodeLocation struct {
 
 type Range struct {
 	begin Begin
+	end   Begin
 }
 
 type Begin struct {
+	offset        int
+	file          string
+	line          int
+	tok_len       int        // the length of the token at offset
 	spelling_file SourceFile // [json: 'spellingLoc']
 }
 
@@ -60,6 +65,15 @@ type AstJsonType struct {
 	qualified           string // [json: 'qualType']
 }
 
+// underlying is the type with typedefs resolved: `angle_t` => `unsigned int`.
+// Clang only sets desugaredQualType when it differs from qualType.
+func (t AstJsonType) underlying() string {
+	if t.desugared_qualified != "" {
+		return t.desugared_qualified
+	}
+	return t.qualified
+}
+
 // ???
 func (p *AstJsonType) str() string {
 	return p.qualified
@@ -117,28 +131,30 @@ func (node *Node) find_children(wanted_kind NodeKind) []*Node {
 	return suitable_children
 }
 
+// Returns an empty `bad` node instead of nil, so that callers can check its kind
+// without nil checks (`if else_st.kindof(compound_stmt)`).
 func (node *Node) try_get_next_child_of_kind(wanted_kind NodeKind) *Node {
 	if node.current_child_id >= len(node.inner) {
-		fmt.Printf("No more children\n")
-		return nil
+		vprintln("No more children")
+		return new(Node)
 	}
 
 	current_child := node.inner[node.current_child_id]
 
 	if !current_child.kindof(wanted_kind) {
-		fmt.Printf("try_get_next_child_of_kind(): WANTED ${%s} BUT GOT ${%s}\n",
+		vprintf("try_get_next_child_of_kind(): WANTED %s BUT GOT %s\n",
 			wanted_kind.str(), current_child.kind.str())
-		return nil
+		return new(Node)
 	}
 
 	node.current_child_id++
 	return current_child
 }
 
-func (node Node) try_get_next_child() *Node {
+func (node *Node) try_get_next_child() *Node {
 	if node.current_child_id >= len(node.inner) {
-		fmt.Printf("No more children\n")
-		return nil
+		vprintln("No more children")
+		return new(Node)
 	}
 
 	current_child := node.inner[node.current_child_id]
@@ -155,6 +171,21 @@ func (node *Node) initialize_node_and_children() {
 	}
 }
 
+// line is the line of the declaration, or where the statement/expression begins
+func (node *Node) line() int {
+	if node.location.line != 0 {
+		return node.location.line
+	}
+	return node.range0.begin.line
+}
+
+func (node *Node) file() string {
+	if node.location.file != "" {
+		return node.location.file
+	}
+	return node.range0.begin.file
+}
+
 func (node *Node) is_builtin() bool {
 	return node.is_invalid_locations() || line_is_builtin_header(node.location.file) ||
 		line_is_builtin_header(node.location.source_file.path) ||
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Offline mode translates ASTs that were dumped before with
+// `clang -Xclang -ast-dump=json -fsyntax-only file.c > file.json`, clang is not needed.
+// `c2v file.json` translates one AST, `c2v -offline folder/` all the ASTs of a folder.
+
+func is_ast_file(path string) bool {
+	return filepath.Ext(path) == ".json" && filepath.Base(path) != "compile_commands.json"
+}
+
+// c_file_for_ast returns the C file the AST was dumped from: `-c_file=path`, or
+// file.c next to file.json. "" if there's none.
+func (c2v *C2V) c_file_for_ast(ast_path string) string {
+	if c2v.c_file_path != "" && !c2v.is_dir {
+		return c2v.c_file_path
+	}
+	c_file := strings.TrimSuffix(ast_path, filepath.Ext(ast_path)) + ".c"
+	if _, err := os.Stat(c_file); err != nil {
+		return ""
+	}
+	return c_file
+}
+
+// is_input_file reports whether a file found in the project folder must be translated
+func (c2v *C2V) is_input_file(path string) bool {
+	if c2v.offline {
+		return is_ast_file(path)
+	}
+	if c2v.is_wrapper {
+		return filepath.Ext(path) == ".h"
+	}
+	return is_c_file(path)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTranslateOfflineAst(t *testing.T) {
+	dir := t.TempDir()
+	ast_path := filepath.Join(dir, "a.json")
+	os.WriteFile(ast_path, []byte(test_emitter_ast_json), 0644)
+	os.WriteFile(filepath.Join(dir, "a.c"), []byte("int counter; int add(int a, int b) {}"), 0644)
+	c2v := test_c2v("-clang=/nonexistent/clang")
+	c2v.set_project_folder(ast_path)
+	c2v.translate_file(ast_path)
+	out, err := os.ReadFile(filepath.Join(dir, "a.v"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the .c file next to the AST is used to skip the declarations of headers
+	if !strings.Contains(string(out), "fn add(") || strings.Contains(string(out), "unused") {
+		t.Errorf("Result:\n%s", out)
+	}
+}
+
+func TestFindOfflineAsts(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a.c", "a.json", "compile_commands.json", "src/b.json"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, nil, 0644)
+	}
+	c2v := test_c2v("-offline")
+	c2v.is_dir = true
+	c2v.set_project_folder(root)
+	paths, _ := c2v.find_c_files(root)
+	if len(paths) != 2 || filepath.Base(paths[0]) != "a.json" || filepath.Base(paths[1]) != "b.json" {
+		t.Errorf("Result: %v, want: a.json and src/b.json", paths)
+	}
+}
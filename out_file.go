@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// os_file is the sink for a translated file. Everything is written to a temporary
+// file in the target folder, which replaces the target only on close(), so an
+// aborted translation never leaves a half written .v file behind.
+type os_file struct {
+	path string
+	tmp  *os.File
+}
+
+func create_out_file(path string) (os_file, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return os_file{}, err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return os_file{}, err
+	}
+	return os_file{path: path, tmp: tmp}, nil
+}
+
+func (p *os_file) write_string(s string) error {
+	_, err := p.tmp.WriteString(s)
+	return err
+}
+
+// close moves the temporary file to its final path
+func (p *os_file) close() error {
+	if err := p.tmp.Close(); err != nil {
+		os.Remove(p.tmp.Name())
+		return err
+	}
+	if err := os.Chmod(p.tmp.Name(), 0644); err != nil {
+		os.Remove(p.tmp.Name())
+		return err
+	}
+	if err := os.Rename(p.tmp.Name(), p.path); err != nil {
+		os.Remove(p.tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// abort drops the temporary file, the target is left untouched
+func (p *os_file) abort() {
+	p.tmp.Close()
+	os.Remove(p.tmp.Name())
+}
+
+func write_file_atomic(path string, content string) error {
+	f, err := create_out_file(path)
+	if err != nil {
+		return err
+	}
+	if err := f.write_string(content); err != nil {
+		f.abort()
+		return err
+	}
+	return f.close()
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOutFileReplacesOnlyOnClose(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "x.v")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := create_out_file(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.write_string("half")
+	f.abort()
+	if out, _ := os.ReadFile(path); string(out) != "old" {
+		t.Errorf("after abort: %q, want: old", out)
+	}
+	f, err = create_out_file(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.write_string("new")
+	if out, _ := os.ReadFile(path); string(out) != "old" {
+		t.Errorf("before close: %q, want: old", out)
+	}
+	if err := f.close(); err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := os.ReadFile(path); string(out) != "new" {
+		t.Errorf("after close: %q, want: new", out)
+	}
+	// no temporary file is left behind
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Result: %d files in the folder, want: 1", len(entries))
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Project is the state shared by all the files of a translated directory: the types,
+// enums and globals that were already generated by one of the files.
+// Files are translated concurrently with `-j N`, so it's only used through its methods.
+// The mirrored output folders are separate modules, so the declarations are shared
+// only by the files of the same output folder (dir).
+type Project struct {
+	mu           sync.Mutex
+	types        map[string][]string            // types[dir], to avoid dups
+	enums        map[string][]string            // enums[dir], to avoid dups
+	enum_vals    map[string]map[string]*str_arr // enum_vals[dir]["Color"] = ["green", "blue"], for converting C globals  to enum values
+	consts       map[string][]string
+	globals      map[string]map[string]*Global
+	globals_out  map[string]map[string]string // `globals_out[dir]["myglobal"] == "extern int myglobal = 0;"`
+	has_cfile    bool
+	translations int                // how many translations were done so far
+	errors       map[string][]error // by the translated file
+	reports      []*FileReport
+}
+
+func new_project() *Project {
+	return &Project{
+		types:       map[string][]string{},
+		enums:       map[string][]string{},
+		enum_vals:   map[string]map[string]*str_arr{},
+		consts:      map[string][]string{},
+		globals:     map[string]map[string]*Global{},
+		globals_out: map[string]map[string]string{},
+		errors:      map[string][]error{},
+	}
+}
+
+func (p *Project) has_type(dir, name string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return ArrayContains(name, p.types[dir])
+}
+
+// add_type returns false if the type was already added (by another file)
+func (p *Project) add_type(dir, name string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ArrayContains(name, p.types[dir]) {
+		return false
+	}
+	p.types[dir] = append(p.types[dir], name)
+	return true
+}
+
+func (p *Project) has_enum(dir, name string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return ArrayContains(name, p.enums[dir])
+}
+
+// add_enum returns false if the enum was already added (by another file)
+func (p *Project) add_enum(dir, name string, vals *str_arr) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ArrayContains(name, p.enums[dir]) {
+		return false
+	}
+	p.enums[dir] = append(p.enums[dir], name)
+	if p.enum_vals[dir] == nil {
+		p.enum_vals[dir] = map[string]*str_arr{}
+	}
+	p.enum_vals[dir][name] = vals
+	return true
+}
+
+// `"red"` => `"Color"`
+func (p *Project) enum_name_of(dir, val string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for enum_name, vals := range p.enum_vals[dir] {
+		if vals.contains(val) {
+			return enum_name
+		}
+	}
+	return ""
+}
+
+func (p *Project) has_const(dir, name string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return ArrayContains(name, p.consts[dir])
+}
+
+// add_const returns false if the const was already added (by another file)
+func (p *Project) add_const(dir, name string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ArrayContains(name, p.consts[dir]) {
+		return false
+	}
+	p.consts[dir] = append(p.consts[dir], name)
+	return true
+}
+
+func (p *Project) global(dir, name string) (*Global, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	g, ok := p.globals[dir][name]
+	return g, ok
+}
+
+func (p *Project) add_global(dir string, g *Global, out string, is_dir bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.globals[dir] == nil {
+		p.globals[dir] = map[string]*Global{}
+		p.globals_out[dir] = map[string]string{}
+	}
+	p.globals[dir][g.name] = g
+	if is_dir {
+		p.globals_out[dir][g.name] = out
+	}
+}
+
+// globals_dirs returns the output folders that have globals
+func (p *Project) globals_dirs() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	dirs := []string{}
+	for dir, out := range p.globals_out {
+		if len(out) > 0 {
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// sorted, so that _globals.v doesn't depend on the order the files were translated in
+func (p *Project) sorted_globals_out(dir string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	names := []string{}
+	for name := range p.globals_out[dir] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := []string{}
+	for _, name := range names {
+		out = append(out, p.globals_out[dir][name])
+	}
+	return out
+}
+
+func (p *Project) set_has_cfile() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.has_cfile = true
+}
+
+func (p *Project) uses_cfile() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.has_cfile
+}
+
+func (p *Project) translated() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.translations++
+}
+
+func (p *Project) add_errors(path string, errs []error) {
+	if len(errs) == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.errors[path] = append(p.errors[path], errs...)
+}
+
+func (p *Project) error_count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for _, errs := range p.errors {
+		n += len(errs)
+	}
+	return n
+}
+
+// error_summary lists the files that had errors, the errors themselves were printed
+// while translating
+func (p *Project) error_summary() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	paths := []string{}
+	n := 0
+	for path, errs := range p.errors {
+		paths = append(paths, path)
+		n += len(errs)
+	}
+	sort.Strings(paths)
+	s := fmt.Sprintf("%d errors in %d files:", n, len(paths))
+	for _, path := range paths {
+		s += fmt.Sprintf("\n  %s: %d", path, len(p.errors[path]))
+	}
+	return s
+}
+
+func (p *Project) add_report(r *FileReport) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reports = append(p.reports, r)
+}
+
+func (p *Project) sorted_reports() []*FileReport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	reports := append([]*FileReport{}, p.reports...)
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Path < reports[j].Path })
+	return reports
+}
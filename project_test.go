@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestForkedFilesShareProject(t *testing.T) {
+	c2v := test_c2v("-j", "4")
+	if c2v.jobs != 4 {
+		t.Fatalf("Result: %v jobs, want: 4", c2v.jobs)
+	}
+	c2v.is_dir = true
+	outs := make([]string, 8)
+	var wg sync.WaitGroup
+	for i := range outs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			root, err := json_decode(test_emitter_ast_json)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			c := c2v.fork()
+			c.tree = root
+			c.c_file_contents = "int counter; int add(int a, int b) {}"
+			for j, node := range c.tree.inner {
+				c.node_i = j
+				c.top_level(node)
+			}
+			outs[i] = c.out.str()
+		}(i)
+	}
+	wg.Wait()
+	structs, enums := 0, 0
+	for _, out := range outs {
+		structs += strings.Count(out, "struct Point {")
+		enums += strings.Count(out, "enum Color {")
+		if strings.Count(out, "fn add(") != 1 {
+			t.Errorf("every file must have its own functions:\n%s", out)
+		}
+	}
+	if structs != 1 || enums != 1 {
+		t.Errorf("Result: %v structs, %v enums, want: 1 of each", structs, enums)
+	}
+	if globals := c2v.proj.sorted_globals_out("."); len(globals) != 1 {
+		t.Errorf("Result: %v globals, want: 1", len(globals))
+	}
+}
+
+func TestSharedDeclsDontDependOnJobs(t *testing.T) {
+	outputs := map[string]string{}
+	for _, jobs := range []string{"1", "8"} {
+		dir := t.TempDir()
+		names := []string{}
+		for i := 0; i < 32; i++ {
+			names = append(names, fmt.Sprintf("f%02d", i))
+		}
+		for i, name := range names {
+			ast := test_emitter_ast_json
+			if i == 0 {
+				// the first file is decoded last
+				ast = strings.Repeat(" ", 1<<22) + ast
+			}
+			os.WriteFile(filepath.Join(dir, name+".json"), []byte(ast), 0644)
+			os.WriteFile(filepath.Join(dir, name+".c"), []byte("int counter; int add(int a, int b) {}"), 0644)
+		}
+		c2v := test_c2v("-q", "-offline", "-j", jobs)
+		defer func() { log_level = log_info }()
+		c2v.is_dir = true
+		c2v.set_project_folder(dir)
+		paths, _ := c2v.find_c_files(dir)
+		c2v.translate_files(paths)
+		for _, name := range names {
+			out, _ := os.ReadFile(filepath.Join(c2v.output_root(), name+".v"))
+			if jobs == "1" {
+				outputs[name] = string(out)
+			} else if string(out) != outputs[name] {
+				t.Errorf("%s.v with -j 8:\n%s\nwith -j 1:\n%s", name, out, outputs[name])
+			}
+		}
+	}
+	if !strings.Contains(outputs["f00"], "struct Point {") || strings.Contains(outputs["f01"], "struct Point {") {
+		t.Errorf("Point must be generated by the first file:\n%s", outputs["f00"])
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// FileReport is what `-report out.json` records about the translation of a file
+type FileReport struct {
+	Path            string          `json:"path"`
+	Output          string          `json:"output,omitempty"`
+	DurationMs      int64           `json:"duration_ms"`
+	Functions       int             `json:"functions"`
+	Structs         int             `json:"structs"`
+	Enums           int             `json:"enums"`
+	Globals         int             `json:"globals"`
+	Macros          int             `json:"macros"`
+	Unhandled       []UnhandledKind `json:"unhandled"`
+	Errors          []string        `json:"errors"`
+	Skipped         []SkippedDecl   `json:"skipped"`
+	SkippedBuiltins int             `json:"skipped_builtins"` // libc declarations, there are too many to list
+	Warnings        []string        `json:"warnings"`
+}
+
+// UnhandledKind counts the nodes of a kind c2v couldn't translate
+type UnhandledKind struct {
+	Kind      string   `json:"kind"`
+	Count     int      `json:"count"`
+	Locations []string `json:"locations"` // `file:line`
+}
+
+// SkippedDecl is a declaration that was intentionally not translated
+type SkippedDecl struct {
+	Name     string `json:"name"`
+	Reason   string `json:"reason"` // "not in file", "duplicate global", ...
+	Location string `json:"location"`
+}
+
+type Report struct {
+	Version    string        `json:"version"`
+	Target     string        `json:"target"`
+	DurationMs int64         `json:"duration_ms"`
+	Translated int           `json:"translated"`
+	Failed     int           `json:"failed"`
+	Files      []*FileReport `json:"files"`
+}
+
+func node_location(node *Node) string {
+	return fmt.Sprintf("%s:%d", node.file(), node.line())
+}
+
+func (c *C2V) skip(node *Node, reason string) {
+	c.report.Skipped = append(c.report.Skipped, SkippedDecl{
+		Name:     node.name,
+		Reason:   reason,
+		Location: node_location(node),
+	})
+}
+
+func (c *C2V) warn(node *Node, msg string) {
+	vprintln(msg)
+	c.report.Warnings = append(c.report.Warnings, node_location(node)+": "+msg)
+}
+
+// add_errors lists the errors and counts the nodes of the kinds c2v doesn't translate
+func (r *FileReport) add_errors(errs []error) {
+	kinds := map[string]*UnhandledKind{}
+	for _, err := range errs {
+		r.Errors = append(r.Errors, err.Error())
+		terr, ok := err.(*TranslationError)
+		if !ok || !terr.unhandled || terr.kind == "" {
+			continue
+		}
+		k := kinds[terr.kind]
+		if k == nil {
+			k = &UnhandledKind{Kind: terr.kind}
+			kinds[terr.kind] = k
+		}
+		k.Count++
+		k.Locations = append(k.Locations, fmt.Sprintf("%s:%d", terr.file, terr.line))
+	}
+	for _, k := range kinds {
+		r.Unhandled = append(r.Unhandled, *k)
+	}
+	sort.Slice(r.Unhandled, func(i, j int) bool {
+		if r.Unhandled[i].Count != r.Unhandled[j].Count {
+			return r.Unhandled[i].Count > r.Unhandled[j].Count
+		}
+		return r.Unhandled[i].Kind < r.Unhandled[j].Kind
+	})
+}
+
+func (c2v *C2V) write_report(path string, duration_ms int64) error {
+	report := Report{
+		Version:    version,
+		Target:     c2v.target,
+		DurationMs: duration_ms,
+		Files:      c2v.proj.sorted_reports(),
+	}
+	for _, r := range report.Files {
+		// `[]` instead of `null`, for the tools reading the report
+		if r.Unhandled == nil {
+			r.Unhandled = []UnhandledKind{}
+		}
+		if r.Errors == nil {
+			r.Errors = []string{}
+		}
+		if r.Skipped == nil {
+			r.Skipped = []SkippedDecl{}
+		}
+		if r.Warnings == nil {
+			r.Warnings = []string{}
+		}
+		if r.Output == "" && len(r.Errors) > 0 {
+			report.Failed++
+		} else {
+			report.Translated++
+		}
+	}
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("cannot write the report: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"a.json": test_emitter_ast_json,
+		"a.c":    "int counter; int puts(const char *s); int add(int a, int b) {}",
+		"e.json": test_errors_ast_json,
+	} {
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+	c2v := test_c2v("-q", "-offline", "-report", "r.json")
+	defer func() { log_level = log_info }()
+	c2v.is_dir = true
+	c2v.set_project_folder(dir)
+	paths, _ := c2v.find_c_files(dir)
+	c2v.translate_files(paths)
+	report_path := filepath.Join(dir, c2v.report_path)
+	if err := c2v.write_report(report_path, 1); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := os.ReadFile(report_path)
+	report := Report{}
+	if err := json.Unmarshal(content, &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Files) != 2 || report.Translated != 2 {
+		t.Fatalf("Result:\n%s", content)
+	}
+	a, e := report.Files[0], report.Files[1]
+	// `puts` is a libc function
+	if a.Functions != 1 || a.SkippedBuiltins != 1 || a.Structs != 1 || a.Enums != 1 || a.Globals != 1 {
+		t.Errorf("Result: %+v", a)
+	}
+	// `unused` is only declared in a header
+	if len(a.Skipped) != 1 || a.Skipped[0].Name != "unused" || a.Skipped[0].Reason != "not in file" {
+		t.Errorf("Result: %+v", a.Skipped)
+	}
+	if len(e.Errors) != 3 || len(e.Unhandled) != 2 || e.Unhandled[1].Locations[0] != "e.c:4" {
+		t.Errorf("Result: %+v", e)
+	}
+}
+
+func TestReportCountsGeneratedEnums(t *testing.T) {
+	c2v := test_c2v()
+	c2v.is_dir = true
+	counts := []int{}
+	for i := 0; i < 2; i++ {
+		root, err := json_decode(test_emitter_ast_json)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := c2v.fork()
+		c.tree = root
+		c.c_file_contents = "int counter; int add(int a, int b) {}"
+		for j, node := range c.tree.inner {
+			c.node_i = j
+			c.top_level(node)
+		}
+		counts = append(counts, c.report.Enums)
+	}
+	// the second file skips the enum, the first one generated it
+	if counts[0] != 1 || counts[1] != 0 {
+		t.Errorf("Result: %v enums, want: [1 0]", counts)
+	}
+}
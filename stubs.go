@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// With `-stubs`, the nodes that can't be translated are replaced with a `TODO c2v` comment
+// containing their C code, so that most of a large project can be translated and the rest
+// finished by hand. The errors are still reported.
+
+// source_slice returns the C code of node, "" when it's not in the translated .c file
+// (it comes from a header, or the .c file of an offline AST is missing)
+func (c *C2V) source_slice(node *Node) string {
+	begin, end := node.range0.begin, node.range0.end
+	if !same_file(begin.file, c.cur_file) || end.file != begin.file {
+		return ""
+	}
+	stop := end.offset + end.tok_len
+	if begin.offset >= stop || stop > len(c.c_file_contents) {
+		return ""
+	}
+	return c.c_file_contents[begin.offset:stop]
+}
+
+// the AST has the paths that were passed to clang, relative or absolute
+func same_file(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	a, b = filepath.ToSlash(filepath.Clean(a)), filepath.ToSlash(filepath.Clean(b))
+	return a == b || strings.HasSuffix(a, "/"+b) || strings.HasSuffix(b, "/"+a)
+}
+
+// stub replaces a declaration or a statement
+func (c *C2V) stub(node *Node) {
+	if !c.stubs {
+		return
+	}
+	c.genln(fmt.Sprintf("// TODO c2v: %s", node.kind_str))
+	for _, line := range strings.Split(c.source_slice(node), "\n") {
+		if line != "" {
+			c.genln("// " + line)
+		}
+	}
+}
+
+// stub_expr replaces an expression inline
+func (c *C2V) stub_expr(node *Node) {
+	if !c.stubs {
+		return
+	}
+	src := strings.Join(strings.Fields(c.source_slice(node)), " ")
+	// the C code can have comments
+	src = strings.ReplaceAll(src, "*/", "* /")
+	c.gen(trim_space(fmt.Sprintf("/* TODO c2v: %s %s", node.kind_str, src)) + " */")
+}
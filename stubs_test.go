@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const test_stubs_c = "_Static_assert(1, \"one\");\nvoid f(void) {\n\textern int x;\n\t({ 1; });\n}\n"
+
+const test_stubs_ast_json = `{
+  "id": "0x1", "kind": "TranslationUnitDecl", "loc": {}, "range": {"begin": {}, "end": {}},
+  "inner": [
+    {"id": "0x2", "kind": "StaticAssertDecl", "loc": {"offset": 0, "file": "s.c", "line": 1, "tokLen": 14},
+     "range": {"begin": {"offset": 0, "tokLen": 14}, "end": {"offset": 23, "tokLen": 1}}},
+    {"id": "0x3", "kind": "FunctionDecl", "loc": {"offset": 31, "line": 2, "tokLen": 1},
+     "range": {"begin": {"offset": 26, "tokLen": 4}, "end": {"offset": 67, "line": 5, "tokLen": 1}},
+     "name": "f", "type": {"qualType": "void (void)"},
+     "inner": [
+       {"id": "0x4", "kind": "CompoundStmt", "range": {"begin": {"offset": 39, "line": 2, "tokLen": 1}, "end": {"offset": 67, "line": 5, "tokLen": 1}},
+        "inner": [
+          {"id": "0x5", "kind": "DeclStmt", "range": {"begin": {"offset": 42, "line": 3, "tokLen": 6}, "end": {"offset": 54, "tokLen": 1}},
+           "inner": [{"id": "0x6", "kind": "VarDecl", "loc": {"offset": 53, "tokLen": 1}, "range": {"begin": {"offset": 42, "tokLen": 6}, "end": {"offset": 53, "tokLen": 1}},
+                      "name": "x", "type": {"qualType": "int"}, "storageClass": "extern"}]},
+          {"id": "0x7", "kind": "StmtExpr", "range": {"begin": {"offset": 57, "line": 4, "tokLen": 1}, "end": {"offset": 64, "tokLen": 1}},
+           "type": {"qualType": "int"}}
+        ]}
+     ]}
+  ]
+}`
+
+func TestStubsKeepTheCCode(t *testing.T) {
+	dir := t.TempDir()
+	ast_path := filepath.Join(dir, "s.json")
+	c_file := filepath.Join(dir, "s.c")
+	os.WriteFile(ast_path, []byte(test_stubs_ast_json), 0644)
+	os.WriteFile(c_file, []byte(test_stubs_c), 0644)
+	c2v := test_c2v("-stubs")
+	out_path := filepath.Join(dir, "s.v")
+	if err := c2v.translate_ast(ast_path, c_file, out_path); err != nil {
+		t.Fatal(err)
+	}
+	out, _ := os.ReadFile(out_path)
+	for _, want := range []string{
+		"// TODO c2v: StaticAssertDecl\n// _Static_assert(1, \"one\")\n",
+		"// TODO c2v: DeclStmt\n\t// extern int x;\n",
+		"/* TODO c2v: StmtExpr ({ 1; }) */",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("%q not found in:\n%s", want, out)
+		}
+	}
+	if len(c2v.errors) != 3 {
+		t.Errorf("Result: %v, the stubs are still errors", c2v.errors)
+	}
+}
+
+func TestLocalExternsAreOneStub(t *testing.T) {
+	c := test_c2v("-stubs")
+	c.c_file_contents = "extern int x, y;"
+	x := &Node{kind: var_decl, kind_str: "VarDecl", name: "x", class_modifier: "extern"}
+	y := &Node{kind: var_decl, kind_str: "VarDecl", name: "y", class_modifier: "extern"}
+	c.var_decl(&Node{kind: decl_stmt, kind_str: "DeclStmt", inner: []*Node{x, y},
+		range0: Range{begin: Begin{offset: 0}, end: Begin{offset: 15, tok_len: 1}}})
+	if got := c.out.str(); strings.Count(got, "TODO") != 1 {
+		t.Errorf("Result:\n%s", got)
+	}
+	if len(c.errors) != 1 || !strings.Contains(c.errors[0].Error(), "`x`, `y`") {
+		t.Errorf("Result: %v", c.errors)
+	}
+}
@@ -0,0 +1,30 @@
+// Copyright 2024 The Authors.
+// Comments must survive the translation.
+
+#define LIMIT 10 // belongs to the macro
+
+/* A point on the grid */
+struct Point {
+	int x; // the column
+	/* the row,
+	   from the top */
+	int y;
+};
+
+enum Mode {
+	MODE_A, // the first mode
+	MODE_B = 4,
+};
+
+int counter; // calls of step()
+
+/**
+ * step moves p by one.
+ */
+int step(struct Point *p) {
+	// go right
+	p->x = p->x + 1;
+	counter = counter + 1; /* counted */
+	return p->x;
+	// unreachable
+}
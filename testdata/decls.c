@@ -0,0 +1,38 @@
+struct User {
+	int age;
+	char *name;
+};
+
+enum Color { RED, GREEN = 5, BLUE };
+
+int counter = 3;
+
+typedef unsigned int angle_t;
+
+angle_t turn(void) {
+	angle_t a = 5;
+	angle_t b;
+	b = a * 2;
+	return b;
+}
+
+int add(int a, int b) {
+	int s = a + b;
+	if (s > 10) {
+		return s;
+	} else {
+		s++;
+	}
+	for (int i = 0; i < 3; i++) {
+		s += i;
+	}
+	switch (s) {
+	case 1:
+	case 2:
+		s = 2;
+		break;
+	default:
+		s = 0;
+	}
+	return s;
+}
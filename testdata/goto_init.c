@@ -0,0 +1,17 @@
+int primes[3] = {2, 3, 5};
+
+struct Point {
+	int x;
+	int y;
+};
+
+int first_odd(void) {
+	struct Point p = {1, 2};
+	int i = 0;
+again:
+	if (primes[i] % 2 == 0) {
+		i++;
+		goto again;
+	}
+	return primes[i] + p.x;
+}
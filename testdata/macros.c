@@ -0,0 +1,19 @@
+#define HEADER_H
+
+#define BUFSIZE 1024
+#define MASK 0x0fu
+#define RATIO 1.5f
+#define BIG (BUFSIZE * 4)
+#define GREETING "hello " "world"
+#define MAX(a, b) ((a) > (b) ? (a) : (b))
+#define SQUARE(x) ((x) * (x))
+#define IS_EVEN(n) ((n) % 2 == 0)
+#define LOG(msg) printf("%s\n", msg)
+
+int buf_size(void) {
+	return BUFSIZE;
+}
+
+int twice(int x) {
+	return x * 2;
+}
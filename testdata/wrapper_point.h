@@ -0,0 +1,22 @@
+#include <stddef.h>
+
+typedef struct {
+	int x;
+	int y;
+} Point;
+
+enum Dir { DIR_UP, DIR_DOWN = 4 };
+
+int point_len(Point *p, int scale);
+void point_reset(Point *p);
+int point_log(const char *fmt, ...);
+static int point_helper(int a) { return a; }
+int _point_private(void);
+int point_parse(const char *s, Point *out);
+long point_sum(const int *xs, size_t n);
+void point_size(const Point *p, int *w, int *h);
+const char *point_dir_name(enum Dir d);
+char *point_name_dup(const Point *p);
+void point_fill(unsigned char *buf);
+void point_inc(int *x);
+void point_count(const Point *p, int *out_n);
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TomlDoc is the subset of TOML used by c2v.toml: tables (`[project]`, `["info.c"]`) with
+// `key = value` pairs, where a value is a string, a bool, an integer or an array of those.
+type TomlDoc struct {
+	tables map[string]map[string]any // keys outside of any table are in tables[""]
+}
+
+func empty_toml_doc() TomlDoc {
+	return TomlDoc{tables: map[string]map[string]any{"": {}}}
+}
+
+func parse_toml(content string) (TomlDoc, error) {
+	doc := empty_toml_doc()
+	table := doc.tables[""]
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fail := func(msg string) (TomlDoc, error) {
+			return doc, fmt.Errorf("line %d: %s", i+1, msg)
+		}
+		if line[0] == '[' {
+			end := strings.LastIndex(line, "]")
+			if end == -1 {
+				return fail("unterminated table header")
+			}
+			if rest := strings.TrimSpace(line[end+1:]); rest != "" && rest[0] != '#' {
+				return fail("unexpected " + rest)
+			}
+			name, rest, err := parse_toml_key(strings.TrimSpace(line[1:end]))
+			if err != nil || rest != "" {
+				return fail("invalid table name " + line[:end+1])
+			}
+			if doc.tables[name] == nil {
+				doc.tables[name] = map[string]any{}
+			}
+			table = doc.tables[name]
+			continue
+		}
+		key, rest, err := parse_toml_key(line)
+		if err != nil {
+			return fail(err.Error())
+		}
+		if !starts_with(rest, "=") {
+			return fail(fmt.Sprintf("expected `=` after %q", key))
+		}
+		val, rest, err := parse_toml_value(strings.TrimSpace(rest[1:]))
+		if err != nil {
+			return fail(err.Error())
+		}
+		if rest != "" && rest[0] != '#' {
+			return fail("unexpected " + rest)
+		}
+		table[key] = val
+	}
+	return doc, nil
+}
+
+// a bare key (`uses_sdl`) or a quoted one (`"info.c"`), returns the rest of the line
+func parse_toml_key(s string) (string, string, error) {
+	if starts_with(s, `"`) || starts_with(s, "'") {
+		val, rest, err := parse_toml_value(s)
+		if err != nil {
+			return "", "", err
+		}
+		return val.(string), rest, nil
+	}
+	end := 0
+	for end < len(s) && (is_ident_char(s[end]) || s[end] == '-') {
+		end++
+	}
+	if end == 0 {
+		return "", "", fmt.Errorf("expected a key, got %q", s)
+	}
+	return s[:end], strings.TrimSpace(s[end:]), nil
+}
+
+func parse_toml_value(s string) (any, string, error) {
+	switch {
+	case starts_with(s, `"`):
+		sb := strings.Builder{}
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '"':
+				return sb.String(), strings.TrimSpace(s[i+1:]), nil
+			case '\\':
+				if i+1 == len(s) {
+					break
+				}
+				i++
+				switch s[i] {
+				case 'n':
+					sb.WriteByte('\n')
+				case 't':
+					sb.WriteByte('\t')
+				default: // `\"`, `\\`
+					sb.WriteByte(s[i])
+				}
+			default:
+				sb.WriteByte(s[i])
+			}
+		}
+		return nil, "", fmt.Errorf("unterminated string %s", s)
+	case starts_with(s, "'"):
+		// literal strings have no escapes: '-IC:\include'
+		end := strings.Index(s[1:], "'")
+		if end == -1 {
+			return nil, "", fmt.Errorf("unterminated string %s", s)
+		}
+		return s[1 : end+1], strings.TrimSpace(s[end+2:]), nil
+	case starts_with(s, "["):
+		arr := []any{}
+		rest := strings.TrimSpace(s[1:])
+		for !starts_with(rest, "]") {
+			val, r, err := parse_toml_value(rest)
+			if err != nil {
+				return nil, "", err
+			}
+			arr = append(arr, val)
+			rest = r
+			if starts_with(rest, ",") {
+				rest = strings.TrimSpace(rest[1:])
+			} else if !starts_with(rest, "]") {
+				return nil, "", fmt.Errorf("expected `,` or `]` in array %s", s)
+			}
+		}
+		return arr, strings.TrimSpace(rest[1:]), nil
+	}
+	end := 0
+	for end < len(s) && s[end] != ' ' && s[end] != '\t' && s[end] != ',' && s[end] != ']' && s[end] != '#' {
+		end++
+	}
+	word, rest := s[:end], strings.TrimSpace(s[end:])
+	if word == "true" || word == "false" {
+		return word == "true", rest, nil
+	}
+	if n, err := strconv.ParseInt(strings.ReplaceAll(word, "_", ""), 0, 64); err == nil {
+		return n, rest, nil
+	}
+	return nil, "", fmt.Errorf("invalid value %q", word)
+}
+
+func (d TomlDoc) value(table, key string) (any, bool) {
+	val, ok := d.tables[table][key]
+	return val, ok
+}
+
+// string_value returns def if the key is missing, arrays are joined with spaces
+// (`additional_flags = ["-I.", "-DFOO"]`)
+func (d TomlDoc) string_value(table, key, def string) string {
+	switch val := d.tables[table][key].(type) {
+	case string:
+		return val
+	case []any:
+		parts := []string{}
+		for _, v := range val {
+			parts = append(parts, fmt.Sprint(v))
+		}
+		return strings.Join(parts, " ")
+	case nil:
+		return def
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+func (d TomlDoc) bool_value(table, key string, def bool) bool {
+	if val, ok := d.tables[table][key].(bool); ok {
+		return val
+	}
+	return def
+}
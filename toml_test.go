@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const test_toml = `
+# c2v configuration
+[project]
+output_dirname = "out"   # relative to the project folder
+additional_flags = ["-I.", '-IC:\include']
+uses_sdl = false
+jobs = 4
+
+["info.c"]
+additional_flags = "-DINFO=\"1\""
+`
+
+func TestParseToml(t *testing.T) {
+	doc, err := parse_toml(test_toml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := doc.string_value("project", "output_dirname", ""); got != "out" {
+		t.Errorf("Result: %q, want: out", got)
+	}
+	if got := doc.string_value("project", "additional_flags", ""); got != `-I. -IC:\include` {
+		t.Errorf("Result: %q", got)
+	}
+	if got := doc.string_value("info.c", "additional_flags", ""); got != `-DINFO="1"` {
+		t.Errorf("Result: %q", got)
+	}
+	if got, _ := doc.value("project", "jobs"); got != int64(4) {
+		t.Errorf("Result: %v, want: 4", got)
+	}
+	if doc.bool_value("project", "uses_sdl", true) {
+		t.Errorf("uses_sdl should be false")
+	}
+	if got := doc.string_value("missing", "x", "def"); got != "def" {
+		t.Errorf("Result: %q, want: def", got)
+	}
+	for _, bad := range []string{"[project", "x = ", `x = "abc`, "x = [1, 2", "= 1", "x = 1 2"} {
+		if _, err := parse_toml(bad); err == nil {
+			t.Errorf("parse_toml(%q) should fail", bad)
+		}
+	}
+}
+
+func TestHandleConfiguration(t *testing.T) {
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "c2v.toml")
+	if err := os.WriteFile(conf, []byte(test_toml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("C2V_CONFIG", conf)
+	c2v := test_c2v()
+	c2v.set_project_folder(dir)
+	if err := c2v.handle_configuration(); err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "out", "_globals.v"); c2v.get_globals_path() != want {
+		t.Errorf("Result: %v, want: %v", c2v.get_globals_path(), want)
+	}
+	c2v.set_config_overrides_for_file(filepath.Join(dir, "info.c"))
+	if got := c2v.get_additional_flags(""); got != `-I. -IC:\include -DINFO="1"` {
+		t.Errorf("Result: %q", got)
+	}
+	c2v.set_config_overrides_for_file(filepath.Join(dir, "main.c"))
+	if got := c2v.get_additional_flags(""); got != `-I. -IC:\include` {
+		t.Errorf("Result: %q", got)
+	}
+}
+
+func TestTypeOverrides(t *testing.T) {
+	if _, ok := c_primitive("boolean"); ok {
+		t.Error("boolean is not a C type")
+	}
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "c2v.toml")
+	t.Setenv("C2V_CONFIG", conf)
+	defer func() { type_overrides = map[string]Prim{} }()
+	c2v := test_c2v()
+	c2v.set_project_folder(dir)
+	os.WriteFile(conf, []byte("[types]\nboolean = \"bool\"\n"), 0644)
+	if err := c2v.handle_configuration(); err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := c_primitive("boolean"); !ok || p.kind != prim_bool {
+		t.Errorf("Result: %v %v, want: bool", p, ok)
+	}
+	os.WriteFile(conf, []byte("[types]\nboolean = \"enum\"\n"), 0644)
+	if err := c2v.handle_configuration(); err == nil {
+		t.Error("enum must be an error")
+	}
+}
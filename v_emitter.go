@@ -0,0 +1,734 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// v_emitter generates V code, the original target of c2v.
+type v_emitter struct {
+	c *C2V
+}
+
+func (e *v_emitter) ext() string {
+	return ".v"
+}
+
+func (e *v_emitter) file_header(body string) string {
+	if e.c.is_wrapper {
+		return e.wrapper_header()
+	}
+	return "[translated]\nmodule main\n\n"
+}
+
+// the declarations of a wrapper module are used by other modules
+func (e *v_emitter) pub() string {
+	if e.c.is_wrapper {
+		return "pub "
+	}
+	return ""
+}
+
+func (e *v_emitter) globals_header() []string {
+	lines := []string{"[translated]\n"}
+	if e.c.proj.uses_cfile() {
+		lines = append(lines, "[typedef]\nstruct C.FILE {}")
+	}
+	return lines
+}
+
+func (e *v_emitter) type_name(c_type string) string {
+	return convert_type(c_type).name
+}
+
+func (e *v_emitter) func_decl(fn *FuncDecl) {
+	c := e.c
+	if c.is_wrapper {
+		e.wrapper_func_decl(fn)
+		return
+	}
+	if fn.is_variadic {
+		// TODO handle this better (`...any` ?)
+		c.genln("[c2v_variadic]")
+	}
+	typ := ""
+	if fn.ret != "void" && fn.name != "main" {
+		typ = convert_type(fn.ret).name
+	}
+	args := []string{}
+	if fn.name != "main" {
+		for _, param := range fn.params {
+			args = append(args, to_lower(filter_name(param.name))+" "+convert_type(param.typ).name)
+		}
+	}
+	str_args := join_strs(args, ", ")
+	if fn.body != nil {
+		v_name := to_lower(fn.name)
+		if v_name != fn.c_name {
+			c.genln(fmt.Sprintf(`[c:"%s"]`, fn.c_name))
+		}
+		c.genln(trim_space(fmt.Sprintf("fn %s(%s) %s", v_name, str_args, typ)) + " {")
+		c.statements(fn.body)
+	} else {
+		lower := to_lower(fn.name)
+		if lower != fn.name {
+			// This fixes unknown symbols errors when building separate .c => .v files into .o files
+			// example:
+			//
+			// [c: "P_TryMove"]
+			// fn p_trymove(thing &Mobj_t, x int, y int) bool
+			//
+			// Now every time `p_trymove` is called, `P_TryMove` will be generated instead.
+			c.genln(fmt.Sprintf(`[c:"%s"]`, fn.name))
+		}
+		c.genln(trim_space(fmt.Sprintf("fn %s(%s) %s", lower, str_args, typ)))
+	}
+	c.genln("")
+}
+
+func (e *v_emitter) struct_decl(s *StructDecl) {
+	c := e.c
+	if c.is_wrapper {
+		e.wrapper_struct_decl(s)
+		return
+	}
+	if (s.name != "struct") && (s.name != "union") {
+		name := capitalize_type(s.name)
+		if s.is_union {
+			c.genln(fmt.Sprintf("union %s {", name))
+		} else {
+			c.genln(fmt.Sprintf("struct %s {", name))
+		}
+	}
+	for _, field := range s.fields {
+		field_type := convert_type(field.typ)
+		field_name := filter_name(field.name)
+		c.gen_doc(field.doc)
+		if ends_with(field_type.name, "_s") { // TODO doom _t _s hack, remove
+			n := field_type.name[:len(field_type.name)-2] + "_t"
+			c.genln(fmt.Sprintf("\t%s %s%s", field_name, n, trailing(field.comment)))
+		} else {
+			c.genln(fmt.Sprintf("\t%s %s%s", field_name, field_type.name, trailing(field.comment)))
+		}
+	}
+	c.genln("}\n")
+}
+
+func (e *v_emitter) enum_decl(en *EnumDecl) bool {
+	c := e.c
+	enum_name := en.name
+	if enum_name == "" {
+		// empty enum means it"s just a list of #define"ed consts
+		c.genln(e.pub() + "const ( // empty enum")
+	} else {
+		enum_name = replace_str(capitalize(enum_name), "Enum ", "")
+		vals := &str_arr{}
+		for _, val := range en.vals {
+			vals.add(filter_name(to_lower(val.name)))
+		}
+		if !c.proj.add_enum(c.out_dir(), enum_name, vals) {
+			return false
+		}
+		vprintf("decl enum \"%s\" with %d vals\n", enum_name, len(vals.inner))
+		c.genln(fmt.Sprintf("%senum %s {", e.pub(), enum_name))
+	}
+	for i, val := range en.vals {
+		name := filter_name(to_lower(val.name))
+		if enum_name == "" {
+			if starts_with(name, "_") || !c.proj.add_const(c.out_dir(), name) {
+				continue
+			}
+		}
+		c.gen_doc(val.doc)
+		c.gen("\t" + name)
+		// handle custom enum vals, e.g. `MF_SHOOTABLE = 4`
+		if val.value != nil {
+			c.gen(" = ")
+			c.skip_parens = true
+			c.expr(val.value)
+			c.skip_parens = false
+		} else if enum_name == "" {
+			c.gen(fmt.Sprintf(" = %d", i))
+		}
+		c.genln(trailing(val.comment))
+	}
+	if enum_name != "" {
+		c.genln("}\n")
+	} else {
+		c.genln(")\n")
+	}
+	return true
+}
+
+func (e *v_emitter) typedef_decl(alias string, c_type string) {
+	c := e.c
+	typ := convert_type(c_type).name
+	if c.in_c_enums(typ) {
+		return
+	}
+	cgen_alias := typ
+	if starts_with(cgen_alias, "_") {
+		cgen_alias = trim_underscores(typ)
+	}
+	if !is_ptr_size(typ) && !starts_with(typ, "fn (") {
+		// TODO handle this better
+		cgen_alias = capitalize(cgen_alias)
+	}
+	c.genln(fmt.Sprintf("%stype %s = %s\n", e.pub(), capitalize(alias), cgen_alias)) // typedef alias (SINGLE LINE)
+}
+
+func (e *v_emitter) macro_name(name string) string {
+	return to_lower(name)
+}
+
+func (e *v_emitter) macro_consts(ms []*Macro) int {
+	c := e.c
+	lines := []string{}
+	for _, m := range ms {
+		name := e.macro_name(m.name)
+		if !c.proj.add_const(c.out_dir(), name) {
+			continue
+		}
+		value := macro_expr(m.toks, e.macro_name, "~")
+		switch m.typ {
+		case "char *":
+			value = "c" + value
+		case "int", "double":
+			// the types of V's untyped numbers
+		default:
+			value = fmt.Sprintf("%s(%s)", convert_type(m.typ).name, value)
+		}
+		lines = append(lines, fmt.Sprintf("\t%s = %s", name, value))
+	}
+	if len(lines) == 0 {
+		return 0
+	}
+	c.genln(e.pub() + "const (")
+	for _, line := range lines {
+		c.genln(line)
+	}
+	c.genln(")\n")
+	return len(lines)
+}
+
+// `#define MAX(a, b) ((a) > (b) ? (a) : (b))` => `fn max[T](a T, b T) T`
+func (e *v_emitter) macro_fn(m *Macro) bool {
+	c := e.c
+	name := e.macro_name(m.name)
+	if !c.proj.add_const(c.out_dir(), name) {
+		return false
+	}
+	name_of := func(s string) string {
+		return to_lower(s)
+	}
+	params := []string{}
+	for _, param := range m.params {
+		params = append(params, name_of(param)+" T")
+	}
+	ret := "T"
+	if m.is_bool {
+		ret = "bool"
+	}
+	c.genln("[inline]")
+	c.genln(fmt.Sprintf("%sfn %s[T](%s) %s {", e.pub(), name, join_strs(params, ", "), ret))
+	if m.is_ternary {
+		c.genln(fmt.Sprintf("\treturn if %s { %s } else { %s }", macro_expr(m.cond, name_of, "~"),
+			macro_expr(m.then, name_of, "~"), macro_expr(m.els, name_of, "~")))
+	} else {
+		c.genln("\treturn " + macro_expr(m.toks, name_of, "~"))
+	}
+	c.genln("}\n")
+	return true
+}
+
+func (e *v_emitter) global(g *GlobalDecl) {
+	c := e.c
+	name := g.name
+	typ := convert_type(g.typ)
+	is_inited := g.init != nil
+	// We assume that if the global"s type is `[N]array`, and it"s initialized,
+	// then it"s constant
+	is_fixed_array := contains(g.typ, "[") && contains(g.typ, "]")
+	is_const := is_inited && (typ.is_const || is_fixed_array)
+	if is_fixed_array && contains(g.typ, "[]") && !contains(g.typ, "*") && !is_inited {
+		// Do not allow uninitialized fixed arrays for now, since they are not supported by V
+		c.add_error(g.node, fmt.Sprintf(`uninitialized fixed array without the size "%s" typ="%s"`, name, g.typ))
+		c.stub(g.node)
+		return
+	}
+	if is_const {
+		c.proj.add_const(c.out_dir(), name)
+		c.gen(fmt.Sprintf("[export:\"%s\"]\nconst (\n%s  ", name, name))
+	} else {
+		if is_inited {
+			c.gen(fmt.Sprintf("[weak] __global ( %s ", name))
+		} else {
+			if contains(typ.name, "anonymous enum") || contains(typ.name, "unnamed enum") {
+				// Skip anon enums, they are declared as consts in V
+				return
+			}
+
+			if g.is_extern && is_fixed_array && g.node.redeclarations_count == 0 {
+				c.gen("[c_extern]")
+			} else {
+				c.gen("[weak]")
+			}
+			c.gen(fmt.Sprintf("__global ( %s %s ", name, typ.name))
+		}
+		c.global_struct_init = typ.name
+	}
+	// if the global has children, that means it"s initialized, parse the expression
+	if is_inited {
+		c.gen(" = ")
+		is_struct := g.init.kindof(init_list_expr) && !is_fixed_array
+		needs_cast := !is_const && !is_struct // Don't generate `foo=Foo(Foo{` if it"s a struct init
+		if needs_cast {
+			c.gen(typ.name + " (")
+		}
+		c.expr(g.init)
+		if needs_cast {
+			c.gen(")")
+		}
+		c.genln("")
+	} else {
+		c.genln("")
+	}
+	c.genln(")\n")
+	c.global_struct_init = ""
+}
+
+func (e *v_emitter) var_decl(var_decl *Node, cinit bool) {
+	c := e.c
+	name := to_lower(filter_name(var_decl.name))
+	typ_ := convert_type(var_decl.ast_type.qualified)
+	if typ_.is_static {
+		c.gen("static ")
+	}
+	// `angle_t a = 5;` => `a := Angle_t(5)`, V would make it an int
+	typedef_name := ""
+	if is_number_typedef(var_decl.ast_type) {
+		typedef_name = e.type_name(var_decl.ast_type.qualified)
+	}
+	if cinit {
+		expr := var_decl.try_get_next_child()
+		c.gen(fmt.Sprintf("%s := ", name))
+		if typedef_name != "" {
+			c.gen(typedef_name + "(")
+			c.expr(expr)
+			c.gen(")")
+			return
+		}
+		c.expr(expr)
+		return
+	}
+	if typedef_name != "" {
+		c.gen(fmt.Sprintf("%s := %s(0)", name, typedef_name))
+		return
+	}
+	// typedefs are resolved, so that `player_t p;` gets a struct zero value
+	oldtyp := var_decl.ast_type.underlying()
+	typ := convert_type(oldtyp).name
+	vprintf("oldtyp=\"%s\" typ=\"%s\"\n", oldtyp, typ)
+	// set default zero value (V requires initialization)
+	def := ""
+	if starts_with(oldtyp, "struct ") {
+		typ = typ_.name
+		def = typ + "{}" // `struct Foo foo;` => `foo := Foo{}` (empty struct init)
+	} else if typ == "u8" {
+		def = "u8(0)"
+	} else if typ == "u16" {
+		def = "u16(0)"
+	} else if typ == "u32" {
+		def = "u32(0)"
+	} else if typ == "u64" {
+		def = "u64(0)"
+	} else if (typ == "size_t") || (typ == "usize") {
+		def = "usize(0)"
+	} else if typ == "i8" {
+		def = "i8(0)"
+	} else if typ == "i16" {
+		def = "i16(0)"
+	} else if typ == "int" {
+		def = "0"
+	} else if typ == "i64" {
+		def = "i64(0)"
+	} else if (typ == "ptrdiff_t") || (typ == "isize") {
+		def = "isize(0)"
+	} else if typ == "bool" {
+		def = "false"
+	} else if typ == "f32" {
+		def = "f32(0.0)"
+	} else if typ == "f64" {
+		def = "0.0"
+	} else if typ == "boolean" {
+		def = "false"
+	} else if ends_with(oldtyp, "*") {
+		// *sqlite3_mutex ==>
+		// &sqlite3_mutex{!}
+		var tt string
+		if starts_with(typ, "&") {
+			tt = typ[1:]
+		} else {
+			tt = typ
+		}
+		def = fmt.Sprintf("&%s(0)", tt)
+	} else if starts_with(typ, "[") {
+		// Empty array init
+		def = typ + "{}"
+	} else {
+		def = typ + "{}"
+	}
+	// vector<int> => int => []int
+	if starts_with(typ, "vector<") {
+		def = sub_str(typ, len("vector<"), len(typ)-1)
+		def = fmt.Sprintf("[]%s", def)
+	}
+	c.gen(fmt.Sprintf("%s := %s", name, def))
+}
+
+// is_number_typedef reports whether a type is a typedef of a number: `angle_t`, `uint32_t`
+func is_number_typedef(t AstJsonType) bool {
+	if t.desugared_qualified == "" || t.desugared_qualified == t.qualified {
+		return false
+	}
+	prim, ok := c_primitive(strings.TrimPrefix(t.desugared_qualified, "const "))
+	return ok && prim.kind != prim_bool && prim.kind != prim_void
+}
+
+func (e *v_emitter) gen_bool(node *Node) {
+	e.c.expr(node)
+}
+
+func (e *v_emitter) stmt(node *Node) bool {
+	if node.kindof(switch_stmt) {
+		e.switch_st(node)
+		return true
+	}
+	return false
+}
+
+func (e *v_emitter) expr(node *Node) bool {
+	c := e.c
+	if node.kindof(character_literal) {
+		// "a"
+		c.gen("`" + fmt.Sprintf("%c", node.value_number) + "`")
+	} else if node.kindof(null_stmt) {
+		c.gen("0 /* null */")
+	} else if node.kindof(unary_operator) && (node.opcode == "++" || node.opcode == "--") {
+		c.expr(node.try_get_next_child())
+		c.gen(" " + node.opcode)
+		if !c.inside_for && !node.is_postfix {
+			// prefix ++
+			// but do not generate `++i` in for loops, it breaks in V for some reason
+			c.gen("$")
+		}
+	} else if node.kindof(string_literal) {
+		// "a" => c"a"
+		c.gen("c" + node.value)
+	} else if node.kindof(unary_expr_or_type_trait_expr) {
+		// sizeof
+		c.gen("sizeof")
+		// sizeof (expr) ?
+		if len(node.inner) > 0 {
+			expr := node.try_get_next_child()
+			c.expr(expr)
+		} else {
+			// sizeof (Type) ?
+			typ := convert_type(node.ast_argument_type.qualified)
+			c.gen(fmt.Sprintf("(%v)", typ.name))
+		}
+	} else if node.kindof(c_style_cast_expr) {
+		// (int*)a  => (int*)(a)
+		// CStyleCastExpr "const char **" <BitCast>
+		expr := node.try_get_next_child()
+		typ := convert_type(node.ast_type.qualified)
+		cast := typ.name
+		if contains(cast, "*") {
+			cast = fmt.Sprintf("(%s)", cast)
+		}
+		c.gen(cast + "(")
+		c.expr(expr)
+		c.gen(")")
+	} else if node.kindof(conditional_operator) {
+		// ? :
+		c.gen("if ") // { } else { }")
+		expr := node.try_get_next_child()
+		case1 := node.try_get_next_child()
+		case2 := node.try_get_next_child()
+		c.expr(expr)
+		c.gen(" { ")
+		c.expr(case1)
+		c.gen(" } else { ")
+		c.expr(case2)
+		c.gen(" }")
+	} else if node.kindof(break_stmt) {
+		// there are no breaks in V match
+		if c.inside_switch == 0 {
+			c.genln("break")
+		}
+	} else if node.kindof(decl_ref_expr) {
+		e.name_expr(node)
+	} else if node.kindof(init_list_expr) {
+		e.init_list_expr(node)
+	} else {
+		return false
+	}
+	return true
+}
+
+func (e *v_emitter) name_expr(node *Node) {
+	c := e.c
+	// `GREEN` => `Color.GREEN`
+	// Find the enum that has this value
+	// vals:
+	// ["int", "EnumConstant", "MT_SPAWNFIRE", "int"]
+	is_enum_val := node.ref_declaration.kind == enum_constant_decl
+
+	if is_enum_val {
+		enum_val := to_lower(node.ref_declaration.name)
+		need_full_enum := true // need `Color.green` instead of just `.green`
+
+		if c.inside_switch != 0 && c.inside_switch_enum {
+			// generate just `match ... { .val { } }`, not `match ... { Enum.val { } }`
+			need_full_enum = false
+		}
+		if c.inside_array_index {
+			need_full_enum = true
+		}
+		enum_name := c.enum_val_to_enum_name(enum_val)
+		if c.inside_array_index {
+			// `foo[ENUM_VAL]` => `foo(int(ENUM_NAME.ENUM_VAL))`
+			c.gen("int(")
+		}
+		if need_full_enum {
+			c.gen(enum_name)
+		}
+		if (enum_val != "true") && (enum_val != "false") && enum_name != "" {
+			// Don't add a `.` before "const" enum vals so that e.g. `tmbbox[BOXLEFT]`
+			// won't get translated to `tmbbox[.boxleft]`
+			// (empty enum name means its enum vals are consts)
+
+			c.gen(".")
+		}
+	}
+
+	name := node.ref_declaration.name
+
+	if !c.in_consts(name) && !c.global_contains(name) {
+		// Functions and variables are all lowercase in V
+		name = to_lower(name)
+		if starts_with(name, "c.") {
+			name = "C." + name[2:] // TODO why is this needed?
+		}
+	}
+
+	c.gen(filter_name(name))
+	if is_enum_val && c.inside_array_index {
+		c.gen(")")
+	}
+}
+
+func (e *v_emitter) init_list_expr(node *Node) {
+	c := e.c
+	t := node.ast_type.qualified
+	// C list init can be an array (`numbers = {1,2,3}` => `numbers = [1,2,3]``)
+	// or a struct init (`user = {"Bob", 20}` => `user = {"Bob", 20}`)
+	is_arr := contains(t, "[")
+	if !is_arr {
+		c.genln(parse_c_struct_name(t) + " {")
+	} else {
+		c.gen("[")
+	}
+	if len(node.array_filler) > 0 {
+		for i, child := range node.array_filler {
+			if child.kindof(implicit_value_init_expr) {
+			} else {
+				c.expr(child)
+				if i < len(node.array_filler)-1 {
+					c.gen(", ")
+				}
+			}
+		}
+	} else {
+		for i, child := range node.inner {
+			// C allows not to set final fields (a = {1,2,,,,})
+			// V requires all fields to be set
+			if child.kindof(implicit_value_init_expr) {
+				c.gen("0/*IMPLICIT*/")
+			} else {
+				c.expr(child)
+				if i < len(node.inner)-1 {
+					c.gen(", ")
+				}
+			}
+		}
+	}
+	is_fixed := contains(node.ast_type.qualified, "[") && contains(node.ast_type.qualified, "]")
+	if !is_arr {
+		c.genln("}")
+	} else {
+		if is_fixed {
+			c.gen("]!")
+		} else {
+			c.gen("]")
+		}
+	}
+}
+
+func (e *v_emitter) case_st(child *Node, is_enum bool) bool {
+	c := e.c
+	if child.kindof(case_stmt) {
+		if is_enum {
+			// Force short `.val {` enum syntax, but only in `case .val:`
+			// Later on it"ll be set to false, so that full syntax is used (`Enum.val`)
+			// Since enums are often used as ints, and V will need the full enum
+			// value to convert it to ints correctly.
+			c.inside_switch_enum = true
+		}
+		case_expr := child.try_get_next_child()
+		c.expr(case_expr)
+		a := child.try_get_next_child()
+		if a.kindof(null0) {
+			a = child.try_get_next_child()
+		}
+		if a.kindof(compound_stmt) {
+			c.genln(" {")
+			c.statements(a)
+		} else if a.kindof(case_stmt) {
+			// case 1:
+			// case 2:
+			// case 3:
+			// ===>
+			// 1, 2, 3 {
+			for a.kindof(case_stmt) {
+				val := a.try_get_next_child()
+				c.gen(", ")
+				c.expr(val) // this is `1` in `case 1:`
+				tmp := a.try_get_next_child()
+				if tmp.kindof(null0) {
+					tmp = a.try_get_next_child()
+				}
+				a = tmp
+			}
+			c.genln(" {")
+			c.inside_switch_enum = false
+			c.statement(a)
+		} else if a.kindof(default_stmt) {
+		} else {
+			// case body
+			c.inside_switch_enum = false
+			c.genln(" {")
+			c.statement(a)
+			if a.kindof(return_stmt) {
+			} else if a.kindof(break_stmt) {
+				return true
+			}
+			if is_enum {
+				c.inside_switch_enum = true
+			}
+		}
+	}
+	return false
+}
+
+// Switch statements are a mess in C...
+func (e *v_emitter) switch_st(switch_node *Node) {
+	c := e.c
+	c.gen("match ")
+	c.inside_switch++
+	expr := switch_node.try_get_next_child()
+	is_enum := false
+	if len(expr.inner) > 0 {
+		// 0
+		x := expr.inner[0]
+		if x.ast_type.qualified == "int" {
+			// this is an int, not a C enum type
+			c.inside_switch_enum = false
+		} else {
+			c.inside_switch_enum = true
+			is_enum = true
+		}
+	}
+	comp_stmt := switch_node.try_get_next_child()
+	// Detect if this switch statement runs on an enum (have to look at the first
+	// value being compared). This means that the integer will have to be cast to this enum
+	// in V.
+	// switch (x) { case enum_val: ... }   ==>
+	// match MyEnum(x) { .enum_val { ... } }
+	// Don't cast if it"s already an enum and not an int. Enum(enum) compiles, but still.
+	second_par := false
+	if len(comp_stmt.inner) > 0 {
+		child := comp_stmt.inner[0]
+		if child.kindof(case_stmt) && len(child.inner) > 0 {
+			case_expr := child.inner[0]
+			if case_expr.kindof(constant_expr) && len(case_expr.inner) > 0 {
+				x := case_expr.inner[0]
+				if x.ref_declaration.kind == enum_constant_decl {
+					is_enum = true
+					c.inside_switch_enum = true
+					c.gen(c.enum_val_to_enum_name(x.ref_declaration.name))
+
+					c.gen("(")
+					second_par = true
+				}
+			}
+		}
+	}
+	c.expr(expr)
+	if second_par {
+		c.gen(")")
+	}
+	c.genln(" {")
+	default_node := new(Node)
+	got_else := false
+	// Switch AST node is weird. First child is a CaseStmt that contains a single child
+	// statement (the first in the block). All other statements in the block are siblings
+	// of this CaseStmt:
+	// switch (x) {
+	//   case 1:
+	//     line1(); // child of CaseStmt
+	//     line2(); // CallExpr (sibling of CaseStmt)
+	//     line3(); // CallExpr (sibling of CaseStmt)
+	// }
+	has_case := false
+	for i, child := range comp_stmt.inner {
+		if child.kindof(case_stmt) {
+			if i > 0 && has_case {
+				c.genln("}")
+			}
+			e.case_st(child, is_enum)
+			has_case = true
+		} else if child.kindof(default_stmt) {
+			default_node = child.try_get_next_child()
+			got_else = true
+		} else {
+			// handle weird children-siblings
+			c.inside_switch_enum = false
+			c.statement(child)
+		}
+	}
+	if got_else {
+		if default_node.kind != bad {
+			if default_node.kindof(case_stmt) {
+				e.case_st(default_node, is_enum)
+				c.genln("}")
+				c.genln("else {")
+			} else {
+				if has_case {
+					c.genln("}")
+				}
+				c.genln("else {")
+				c.statement(default_node)
+			}
+			c.genln("}")
+		}
+	} else {
+		if has_case {
+			c.genln("}")
+		}
+		c.genln("else {}")
+	}
+	c.genln("}")
+	c.inside_switch--
+	c.inside_switch_enum = false
+}
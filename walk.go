@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// find_c_files returns all the .c files (the .json ASTs with `-offline`) under root, filtered by the `-include=`/`-exclude=`
+// globs. The output folder and hidden folders are skipped.
+func (c2v *C2V) find_c_files(root string) ([]string, error) {
+	paths := []string{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if path != root && (d.Name() == c2v.project_output_dirname || starts_with(d.Name(), ".") ||
+				path == c2v.output_root()) {
+				return filepath.SkipDir
+			}
+			if path != root && c2v.is_excluded(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !c2v.is_input_file(path) || c2v.is_excluded(rel) {
+			return nil
+		}
+		if len(c2v.include_globs) > 0 && !match_any_glob(c2v.include_globs, rel) {
+			return nil
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	return paths, err
+}
+
+func (c2v *C2V) is_excluded(rel string) bool {
+	return match_any_glob(c2v.exclude_globs, rel)
+}
+
+// A pattern without a `/` is matched against the file name only, so `-exclude=*_test.c`
+// works in any folder.
+func match_any_glob(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := filepath.Match(pattern, filepath.Base(rel)); ok {
+				return true
+			}
+			continue
+		}
+		if match_glob(strings.Split(pattern, "/"), strings.Split(rel, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// match_glob matches path segments, `**` matches any number of folders:
+// `src/**/*.c` matches `src/a.c` and `src/x/y/a.c`
+func match_glob(pattern []string, path []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			if match_glob(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(path) == 0 {
+		return false
+	}
+	if ok, _ := filepath.Match(pattern[0], path[0]); !ok {
+		return false
+	}
+	return match_glob(pattern[1:], path[1:])
+}
+
+// output_root is where the files of a translated folder go: `-o dir`, or
+// `<project>/c2v_out.dir` (`[project] output_dirname`)
+func (c2v *C2V) output_root() string {
+	if c2v.output_dir != "" {
+		if abs, err := filepath.Abs(c2v.output_dir); err == nil {
+			return abs
+		}
+		return c2v.output_dir
+	}
+	return filepath.Join(c2v.project_folder, c2v.project_output_dirname)
+}
+
+// out_path mirrors the source tree: `<project>/src/a/b.c` => `<project>/c2v_out.dir/src/a/b.v`
+// A single file is translated next to itself, or into `-o dir`.
+func (c2v *C2V) out_path(c_file string) string {
+	name := strings.TrimSuffix(filepath.Base(c_file), filepath.Ext(c_file)) + c2v.emitter.ext()
+	if !c2v.is_dir {
+		if c2v.output_dir != "" {
+			return filepath.Join(c2v.output_dir, name)
+		}
+		return filepath.Join(filepath.Dir(c_file), name)
+	}
+	rel, err := filepath.Rel(c2v.project_folder, filepath.Dir(c_file))
+	if err != nil || starts_with(rel, "..") {
+		rel = ""
+	}
+	return filepath.Join(c2v.output_root(), rel, name)
+}
+
+// out_dir is the output folder of the translated file: its module, where its globals go
+func (c *C2V) out_dir() string {
+	return filepath.Dir(c.outv)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindCFiles(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a.c", "a.h", "src/b.c", "src/x/c.c", "src/x/c_test.c",
+		"vendor/d.c", ".git/e.c", "c2v_out.dir/f.c"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, nil, 0644)
+	}
+	c2v := test_c2v("-exclude=vendor,*_test.c")
+	c2v.is_dir = true
+	c2v.set_project_folder(root)
+	paths, err := c2v.find_c_files(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rels := []string{}
+	for _, path := range paths {
+		rel, _ := filepath.Rel(root, path)
+		rels = append(rels, filepath.ToSlash(rel))
+	}
+	want := []string{"a.c", "src/b.c", "src/x/c.c"}
+	if !reflect.DeepEqual(rels, want) {
+		t.Errorf("Result: %v, want: %v", rels, want)
+	}
+
+	c2v.include_globs = []string{"src/**/*.c"}
+	paths, _ = c2v.find_c_files(root)
+	if len(paths) != 2 {
+		t.Errorf("Result: %v, want: src/b.c and src/x/c.c", paths)
+	}
+
+	out := c2v.out_path(filepath.Join(root, "src", "x", "c.c"))
+	if want := filepath.Join(root, "c2v_out.dir", "src", "x", "c.v"); out != want {
+		t.Errorf("Result: %v, want: %v", out, want)
+	}
+}
+
+func TestGlobalsPerOutputFolder(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a", "src/b"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path+".json", []byte(test_emitter_ast_json), 0644)
+		os.WriteFile(path+".c", []byte("int counter; int add(int a, int b) {}"), 0644)
+	}
+	c2v := test_c2v("-q", "-offline")
+	defer func() { log_level = log_info }()
+	c2v.is_dir = true
+	c2v.set_project_folder(root)
+	paths, _ := c2v.find_c_files(root)
+	c2v.translate_files(paths)
+	if err := c2v.save_globals(); err != nil {
+		t.Fatal(err)
+	}
+	// src is another module, it can't use the globals of the root one
+	for _, dir := range []string{"", "src"} {
+		out, _ := os.ReadFile(filepath.Join(c2v.output_root(), dir, "_globals.v"))
+		if !strings.Contains(string(out), "counter") {
+			t.Errorf("%s/_globals.v:\n%s", dir, out)
+		}
+	}
+}
+
+func TestDeclsPerOutputFolder(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"x/a", "x/b", "y/c"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path+".json", []byte(test_emitter_ast_json), 0644)
+		os.WriteFile(path+".c", []byte("int counter; int add(int a, int b) {}"), 0644)
+	}
+	c2v := test_c2v("-q", "-offline")
+	defer func() { log_level = log_info }()
+	c2v.is_dir = true
+	c2v.set_project_folder(root)
+	paths, _ := c2v.find_c_files(root)
+	c2v.translate_files(paths)
+	if err := c2v.save_globals(); err != nil {
+		t.Fatal(err)
+	}
+	structs := map[string]int{}
+	for _, name := range []string{"x/a", "x/b", "y/c"} {
+		out, _ := os.ReadFile(filepath.Join(c2v.output_root(), filepath.FromSlash(name)+".v"))
+		structs[filepath.Dir(name)] += strings.Count(string(out), "struct Point {")
+	}
+	// once per module
+	if structs["x"] != 1 || structs["y"] != 1 {
+		t.Errorf("Result: %v", structs)
+	}
+	if _, err := os.Stat(filepath.Join(c2v.output_root(), "_globals.v")); err == nil {
+		t.Error("_globals.v was written into a folder without globals")
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// `c2v wrapper foo.h` generates a V module binding the public API of a C header: the C
+// declarations (`fn C.foo_init()`, `struct C.Foo`), and thin wrappers with V names.
+
+// module_name_of turns `SDL_image.h` into `sdl_image`
+func module_name_of(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	sb := strings.Builder{}
+	for i := 0; i < len(name); i++ {
+		if is_ident_char(name[i]) {
+			sb.WriteByte(name[i])
+		} else {
+			sb.WriteByte('_')
+		}
+	}
+	return to_lower(sb.String())
+}
+
+func (e *v_emitter) wrapper_header() string {
+	return fmt.Sprintf("[translated]\nmodule %s\n\n#include \"%s\"\n\n", e.c.wrapper_module_name,
+		filepath.Base(e.c.cur_file))
+}
+
+func (e *v_emitter) wrapper_func_decl(fn *FuncDecl) {
+	c := e.c
+	params := []string{}
+	names := []string{}
+	for i, param := range fn.params {
+		name := to_lower(filter_name(param.name))
+		if param.name == "" {
+			// `int foo(int);`
+			name = fmt.Sprintf("arg%d", i)
+		}
+		params = append(params, name+" "+convert_type(param.typ).name)
+		names = append(names, name)
+	}
+	ret := ""
+	if fn.ret != "void" {
+		ret = convert_type(fn.ret).name
+	}
+	c_params := join_strs(params, ", ")
+	if fn.is_variadic {
+		c_params = trim_space(strings.TrimPrefix(c_params+", ...", ", "))
+	}
+	c.genln(trim_space(fmt.Sprintf("fn C.%s(%s) %s", fn.c_name, c_params, ret)))
+	c.genln("")
+	if fn.is_variadic {
+		// the variadic args can't be passed on, `C.foo()` has to be called directly
+		return
+	}
+	call := fmt.Sprintf("C.%s(%s)", fn.c_name, join_strs(names, ", "))
+	if ret != "" {
+		call = "return " + call
+	}
+	c.genln(trim_space(fmt.Sprintf("pub fn %s(%s) %s", to_lower(fn.name), join_strs(params, ", "), ret)) + " {")
+	c.genln("\t" + call)
+	c.genln("}\n")
+}
+
+func (e *v_emitter) wrapper_struct_decl(s *StructDecl) {
+	c := e.c
+	if s.name == "struct" || s.name == "union" {
+		// anonymous, only used in a field
+		return
+	}
+	if s.is_typedef {
+		c.genln("[typedef]")
+	}
+	kind := "struct"
+	if s.is_union {
+		kind = "union"
+	}
+	c.genln(fmt.Sprintf("%s C.%s {", kind, s.name))
+	for _, field := range s.fields {
+		c.gen_doc(field.doc)
+		c.genln(fmt.Sprintf("\t%s %s%s", filter_name(field.name), convert_type(field.typ).name,
+			trailing(field.comment)))
+	}
+	c.genln("}\n")
+	c.genln(fmt.Sprintf("pub type %s = C.%s\n", capitalize_type(s.name), s.name))
+}
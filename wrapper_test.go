@@ -0,0 +1,15 @@
+package main
+
+import "testing"
+
+func TestModuleNameOf(t *testing.T) {
+	for path, want := range map[string]string{
+		"SDL_image.h":         "sdl_image",
+		"include/stb-image.h": "stb_image",
+		"zlib.h":              "zlib",
+	} {
+		if got := module_name_of(path); got != want {
+			t.Errorf("module_name_of(%q) = %q, want %q", path, got, want)
+		}
+	}
+}